@@ -4,16 +4,18 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/biliqiqi/ac2/internal/control"
 	"github.com/biliqiqi/ac2/internal/logger"
 	"github.com/biliqiqi/ac2/internal/pool"
 	"github.com/biliqiqi/ac2/internal/webterm"
 )
 
 // runHeadless runs ac2 without a local TUI and waits for shutdown signals.
-func runHeadless(agentPool *pool.AgentPool, mainAgent *pool.AgentInstance, webServer *webterm.Server, pidPath string) error {
+func runHeadless(agentPool *pool.AgentPool, controller *control.Controller, webServer *webterm.Server, pidPath string) error {
 	if err := writePIDFile(pidPath); err != nil {
 		return err
 	}
@@ -23,19 +25,38 @@ func runHeadless(agentPool *pool.AgentPool, mainAgent *pool.AgentInstance, webSe
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	defer signal.Stop(sigCh)
 
+	// Restarts keep the entry agent alive; only its final exit ends ac2
+	agentPool.AddRestartHandler(func(event pool.RestartEvent) {
+		fmt.Printf("[ac2] %s\n", event)
+	})
+
+	// Operators can quit from the web terminal
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	controller.SetQuitHandler(func() {
+		quitOnce.Do(func() { close(quit) })
+	})
+
+	// A restart or switch from the web terminal may replace the entry
+	// agent; follow the replacement instead of ending ac2
 	agentExit := make(chan error, 1)
-	if mainAgent != nil {
-		go func() {
-			err := <-mainAgent.ExitCh
-			agentExit <- err
-		}()
-	}
+	go func() {
+		for agent := controller.Main(); agent != nil; agent = controller.Main() {
+			err := <-agent.ExitCh
+			if _, isMain := controller.Settle(agent); isMain {
+				agentExit <- err
+				return
+			}
+		}
+	}()
 
 	select {
 	case sig := <-sigCh:
 		logger.Printf("NoTUI: received signal %v, shutting down", sig)
 	case err := <-agentExit:
 		logger.Printf("NoTUI: agent exited (%v), shutting down", err)
+	case <-quit:
+		logger.Printf("NoTUI: quit from web terminal, shutting down")
 	}
 
 	shutdownDone := make(chan struct{})
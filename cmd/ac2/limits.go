@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/biliqiqi/ac2/internal/pool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxConcurrent    int
+	agentConcurrency []string
+)
+
+// addConcurrencyFlags registers the delegated-call limit flags on cmd.
+func addConcurrencyFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 4, "max delegated agent calls running at once, others wait in a queue (0 = unlimited)")
+	cmd.Flags().StringArrayVar(&agentConcurrency, "agent-concurrency", nil, "per-agent limit TYPE=N for delegated calls, e.g. codex=1 (repeatable)")
+}
+
+// applyConcurrencyLimits configures agentPool from the concurrency flags.
+func applyConcurrencyLimits(agentPool *pool.AgentPool) error {
+	if maxConcurrent < 0 {
+		return fmt.Errorf("--max-concurrent must not be negative")
+	}
+	perType := make(map[string]int, len(agentConcurrency))
+	for _, entry := range agentConcurrency {
+		agentType, value, ok := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(value)
+		if !ok || agentType == "" || err != nil || limit < 0 {
+			return fmt.Errorf("invalid --agent-concurrency %q, expected TYPE=N", entry)
+		}
+		perType[agentType] = limit
+	}
+	agentPool.SetConcurrencyLimits(maxConcurrent, perType)
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/biliqiqi/ac2/internal/control"
 	"github.com/biliqiqi/ac2/internal/detector"
 	"github.com/biliqiqi/ac2/internal/logger"
 	"github.com/biliqiqi/ac2/internal/pool"
@@ -21,11 +22,23 @@ import (
 
 var (
 	entryAgent string
+	entryDir   string
+	entryArgs  string
+	entryEnv   []string
 	webPort    int
 	webUser    string
 	webPass    string
+	viewerUser string
+	viewerPass string
+	webShare   bool
 	noTUI      bool
 	pidFile    string
+	mcpHTTP    string
+	mcpURL     string
+	mcpToken   string
+	recordDir  string
+	webSize    string
+	webOrigins []string
 )
 
 func main() {
@@ -45,16 +58,37 @@ func main() {
 	}
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
-	rootCmd.Flags().StringVarP(&entryAgent, "entry", "e", "", "entry agent (claude, codex, gemini)")
+	rootCmd.Flags().StringVarP(&entryAgent, "entry", "e", "", "entry agent type (claude, codex, gemini or a custom agent from agents.toml)")
+	rootCmd.Flags().StringVar(&entryDir, "entry-dir", "", "working directory for the entry agent")
+	rootCmd.Flags().StringVar(&entryArgs, "entry-args", "", "extra CLI arguments for the entry agent (e.g. \"--model opus\")")
+	rootCmd.Flags().StringArrayVar(&entryEnv, "entry-env", nil, "environment override KEY=VALUE for the entry agent (repeatable)")
 	rootCmd.Flags().IntVar(&webPort, "web-port", 8080, "web terminal port")
-	rootCmd.Flags().StringVar(&webUser, "web-user", "", "web terminal username for Basic Auth")
-	rootCmd.Flags().StringVar(&webPass, "web-pass", "", "web terminal password for Basic Auth")
+	rootCmd.Flags().StringVar(&webUser, "web-user", "", "web terminal username")
+	rootCmd.Flags().StringVar(&webPass, "web-pass", "", "web terminal password (visible in ps and shell history; prefer --web-auth-file)")
+	rootCmd.Flags().StringVar(&viewerUser, "web-viewer-user", "", "username for read-only web access")
+	rootCmd.Flags().StringVar(&viewerPass, "web-viewer-pass", "", "password for read-only web access")
+	rootCmd.Flags().BoolVar(&webShare, "web-share", false, "print a read-only share link that needs no credentials")
 	rootCmd.Flags().BoolVar(&noTUI, "no-tui", false, "run without local TUI (web terminal only)")
+	rootCmd.Flags().StringSliceVar(&webOrigins, "web-allowed-origins", nil, "other origins allowed to open the web terminal, e.g. https://ac2.example.com (comma-separated or repeatable)")
+	rootCmd.Flags().StringVar(&webSize, "web-size-policy", webterm.SizeActive, "terminal size with several viewers: active (who typed last), smallest, or fixed:COLSxROWS")
+	rootCmd.Flags().StringVar(&mcpHTTP, "mcp-http", "", "serve MCP over HTTP on this address (e.g. 127.0.0.1:7331) and connect launched agents to it")
+	rootCmd.Flags().StringVar(&mcpURL, "mcp-url", "", "connect launched agents to an existing ac2 mcp-serve base URL (e.g. http://127.0.0.1:7331)")
+	rootCmd.Flags().StringVar(&mcpToken, "mcp-token", "", "bearer token for the MCP server (default $AC2_MCP_TOKEN; generated for --mcp-http)")
+	rootCmd.Flags().StringVar(&recordDir, "record-dir", "", "record every agent session to an asciicast v2 file in this directory")
+	addConcurrencyFlags(rootCmd)
+	addOutputFlags(rootCmd)
+	addRestartFlags(rootCmd)
+	addWebAuthFlags(rootCmd)
+	addTLSFlags(rootCmd)
+	addWebBindFlags(rootCmd)
 	rootCmd.PersistentFlags().StringVar(&pidFile, "pid-file", defaultPIDFile, "pid file path for no-tui mode")
 
 	// Add subcommands
 	rootCmd.AddCommand(getMCPStdioCmd())
+	rootCmd.AddCommand(getMCPServeCmd())
 	rootCmd.AddCommand(getStopCmd())
+	rootCmd.AddCommand(getReplayCmd())
+	rootCmd.AddCommand(getWebPasswdCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -77,7 +111,10 @@ func run(cmd *cobra.Command, args []string) error {
 	fmt.Println("ac2 - agentic cli toolkit")
 	fmt.Println()
 
-	det := detector.New()
+	det, err := detector.New()
+	if err != nil {
+		return err
+	}
 	agents := det.Scan()
 
 	available := det.GetAvailable()
@@ -86,18 +123,38 @@ func run(cmd *cobra.Command, args []string) error {
 		fmt.Println("  - Claude Code: https://claude.ai/code")
 		fmt.Println("  - Codex CLI")
 		fmt.Println("  - Gemini CLI")
+		fmt.Printf("Or define custom agents in %s\n", detector.ConfigPath())
 		return nil
 	}
 
-	// Check and find available port before displaying to user
-	availablePort, err := findAvailablePort(webPort, 10)
+	sizePolicy, err := webterm.ParseSizePolicy(webSize)
+	if err != nil {
+		return fmt.Errorf("invalid --web-size-policy: %w", err)
+	}
+	allowedOrigins, err := webterm.ParseOrigins(webOrigins)
+	if err != nil {
+		return fmt.Errorf("invalid --web-allowed-origins: %w", err)
+	}
+
+	tlsCertFile, tlsKeyFile, tlsFingerprint, err := webTLS()
+	if err != nil {
+		return err
+	}
+	webScheme := "http"
+	if tlsCertFile != "" {
+		webScheme = "https"
+	}
+
+	// Listen before displaying the address, finding a free port if needed
+	webListener, availablePort, err := listenWeb(webBind, webPort, 10)
 	if err != nil {
 		return err
 	}
-	if availablePort != webPort {
+	if availablePort != webPort && availablePort != 0 {
 		fmt.Printf("\033[33mWarning: Port %d is already in use, will use port %d instead\033[0m\n\n", webPort, availablePort)
 		webPort = availablePort
 	}
+	webBase := webBaseURL(webScheme, webListener)
 
 	var entry *detector.AgentInfo
 
@@ -115,7 +172,7 @@ func run(cmd *cobra.Command, args []string) error {
 		if noTUI {
 			return fmt.Errorf("--no-tui requires --entry")
 		}
-		fmt.Printf("Web terminal will listen at http://localhost:%d\n\n", webPort)
+		fmt.Printf("Web terminal will listen at %s\n\n", webBase)
 		fmt.Println("Select entry agent:")
 		for _, a := range agents {
 			if a.Found {
@@ -143,7 +200,12 @@ func run(cmd *cobra.Command, args []string) error {
 		flushStdin()
 	}
 
-	if webUser == "" && webPass == "" && !noTUI {
+	accounts, accountsSource, err := loadWebAccounts()
+	if err != nil {
+		return err
+	}
+
+	if webUser == "" && webPass == "" && len(accounts) == 0 && !webToken && !noTUI {
 		user, pass, err := promptWebAuth()
 		if err != nil {
 			return err
@@ -152,11 +214,63 @@ func run(cmd *cobra.Command, args []string) error {
 		webPass = pass
 	}
 
-	// Create Agent Pool (no MCP HTTP server needed)
-	agentPool := pool.NewAgentPool(available, "")
+	hasOperator := (webUser != "" && webPass != "") || hasOperatorAccount(accounts) || webToken
+	if (viewerUser != "" || webShare) && !hasOperator {
+		return fmt.Errorf("--web-viewer-user and --web-share require operator credentials (--web-user and --web-pass, --web-auth-file or --web-token), otherwise every client can type")
+	}
+	if (viewerUser == "") != (viewerPass == "") {
+		return fmt.Errorf("--web-viewer-user and --web-viewer-pass must be set together")
+	}
+	authEnabled := webUser != "" || webPass != "" || len(accounts) > 0 || webToken
+	if !authEnabled && !isLocalWebBind(webBind) && !webInsecureBind {
+		_ = webListener.Close()
+		return fmt.Errorf("refusing to serve the web terminal on %s without authentication; set up a login (--web-auth-file, --web-token or --web-user and --web-pass) or pass --web-insecure-bind", webBind)
+	}
+	shareToken := ""
+	if webShare {
+		shareToken = newToken()
+	}
+
+	if mcpHTTP != "" && mcpURL != "" {
+		return fmt.Errorf("--mcp-http and --mcp-url cannot be used together")
+	}
+	if mcpToken == "" {
+		mcpToken = os.Getenv("AC2_MCP_TOKEN")
+	}
+
+	// Create Agent Pool, optionally pointing launched agents at an MCP server
+	mcpBase := strings.TrimSuffix(strings.TrimSuffix(mcpURL, "/"), "/mcp")
+	var mcpListener net.Listener
+	if mcpHTTP != "" {
+		mcpListener, mcpBase, mcpToken, err = startEmbeddedMCP(mcpHTTP, mcpToken)
+		if err != nil {
+			return err
+		}
+	}
+	agentPool := pool.NewAgentPool(available, mcpBase)
+	agentPool.SetMCPToken(mcpToken)
+	if err := applyConcurrencyLimits(agentPool); err != nil {
+		return err
+	}
+	if err := applyOutputBuffer(agentPool); err != nil {
+		return err
+	}
+	agentPool.SetRecordDir(recordDir)
+	if mcpListener != nil {
+		serveEmbeddedMCP(agentPool, mcpListener, mcpToken)
+	}
 
 	// Create initial agent instance
-	options := []pool.AgentOption{}
+	restart, err := restartOption()
+	if err != nil {
+		return err
+	}
+	options := []pool.AgentOption{
+		pool.WithWorkDir(entryDir),
+		pool.WithArgs(strings.Fields(entryArgs)...),
+		pool.WithEnv(entryEnv...),
+		restart,
+	}
 	if !noTUI {
 		options = append(options, pool.WithOutputSink(os.Stdout))
 	} else {
@@ -168,7 +282,26 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	// Start Web Terminal Server (always enabled)
-	webServer := webterm.NewServer(webPort, webUser, webPass, mainAgent.Name)
+	webServer := webterm.NewServer(webPort, webUser, webPass, mainAgent.DisplayName())
+	webServer.SetAgentPool(agentPool)
+	webServer.SetRecordDir(recordDir)
+	webServer.SetSizePolicy(sizePolicy)
+	webServer.SetViewerAuth(viewerUser, viewerPass)
+	webServer.SetShareToken(shareToken)
+	webServer.AddAccounts(accounts...)
+	webServer.SetSessionTTL(webSessionTTL)
+	webServer.SetTLS(tlsCertFile, tlsKeyFile)
+	webServer.SetAllowedOrigins(allowedOrigins)
+	webServer.SetListener(webListener)
+	controller := control.New(agentPool, mainAgent)
+	webServer.SetController(controller)
+	agentPool.SetForeground(func(agent *pool.AgentInstance) bool {
+		return agent == controller.Main() || agent == controller.Current()
+	})
+	loginToken := ""
+	if hasOperator {
+		loginToken = webServer.NewAccessToken()
+	}
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -176,8 +309,8 @@ func run(cmd *cobra.Command, args []string) error {
 			}
 			logger.Printf("Web Terminal Server goroutine exiting")
 		}()
-		logger.Printf("Web Terminal Server goroutine started, listening on port %d...", webPort)
-		if err := webServer.Start(mainAgent.Proxy); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Printf("Web Terminal Server goroutine started, listening on %s...", webBase)
+		if err := webServer.Start(mainAgent.Proxy()); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Printf("Web Terminal Server error: %v", err)
 		}
 		logger.Printf("Web Terminal Server gracefully stopped")
@@ -188,42 +321,54 @@ func run(cmd *cobra.Command, args []string) error {
 
 	// Display Web Terminal info
 	lines := []string{
-		fmt.Sprintf("Web Terminal: http://localhost:%d", webPort),
+		fmt.Sprintf("Web Terminal: %s", webBase),
 		fmt.Sprintf("Entry Agent: %s", mainAgent.ID),
 	}
-	if webUser != "" && webPass != "" {
+	if tlsFingerprint != "" {
+		lines = append(lines, fmt.Sprintf("TLS SHA-256: %s", tlsFingerprint))
+	}
+	switch {
+	case webUser != "" && webPass != "":
 		lines = append(lines, fmt.Sprintf("Auth: %s / %s", webUser, "********"))
-	} else {
-		lines = append(lines, "Auth: None (use --web-user and --web-pass)")
+	case len(accounts) > 0:
+		lines = append(lines, fmt.Sprintf("Auth: %d account(s) from %s", len(accounts), accountsSource))
+	case webToken:
+		lines = append(lines, "Auth: login link only")
+	default:
+		lines = append(lines, "Auth: None (use --web-auth-file, --web-token or --web-user and --web-pass)")
+	}
+	if loginToken != "" {
+		lines = append(lines, fmt.Sprintf("Login link: %s", webLink(webBase, "/?token="+loginToken)))
+	}
+	if viewerUser != "" {
+		lines = append(lines, fmt.Sprintf("Viewer: %s / %s", viewerUser, "********"))
+	}
+	if shareToken != "" {
+		lines = append(lines, fmt.Sprintf("Viewer link: %s", webLink(webBase, "/?share="+shareToken)))
+	}
+	if mcpBase != "" {
+		lines = append(lines, fmt.Sprintf("MCP: %s/mcp", mcpBase))
+	}
+	if mainAgent.RecordingPath != "" {
+		lines = append(lines, fmt.Sprintf("Recording: %s", mainAgent.RecordingPath))
+		lines = append(lines, fmt.Sprintf("Replay: %s", webLink(webBase, "/replay")))
 	}
 	printBox(lines)
 
 	if noTUI {
 		logger.Printf("Main: starting no-tui mode")
-		return runHeadless(agentPool, mainAgent, webServer, pidFile)
+		return runHeadless(agentPool, controller, webServer, pidFile)
 	}
 
 	// Start Passthrough TUI
 	logger.Printf("Main: starting Passthrough TUI")
-	pt := tui.NewPassthrough(agentPool, mainAgent, "", webServer)
+	pt := tui.NewPassthrough(agentPool, controller, "", webServer)
 	err = pt.Run()
 	logger.Printf("Main: Passthrough TUI returned with err=%v", err)
 	logger.Printf("Main: run() function returning, all defers will execute")
 	return err
 }
 
-func findAvailablePort(startPort int, maxRetries int) (int, error) {
-	for i := 0; i < maxRetries; i++ {
-		port := startPort + i
-		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-		if err == nil {
-			_ = listener.Close()
-			return port, nil
-		}
-	}
-	return 0, fmt.Errorf("no available port found from %d to %d", startPort, startPort+maxRetries-1)
-}
-
 func promptWebAuth() (string, string, error) {
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Print("Web terminal auth username(leave empty for no auth): ")
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/biliqiqi/ac2/internal/mcp"
+	"github.com/biliqiqi/ac2/internal/pool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mcpServeHTTP  string
+	mcpServeUnix  string
+	mcpServeToken string
+)
+
+// getMCPServeCmd returns the mcp-serve subcommand
+func getMCPServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mcp-serve",
+		Short: "Run ac2 as a long-lived MCP server over HTTP, SSE and/or a unix socket",
+		Long: `Run ac2 as a long-lived MCP server shared by many clients.
+
+Endpoints with --http:
+    POST /mcp        streamable HTTP
+    GET  /mcp/sse    SSE
+    GET  /health     health check
+
+Add to Claude Code with:
+
+    claude mcp add --transport http ac2 http://localhost:7331/mcp \
+        --header "Authorization: Bearer $AC2_MCP_TOKEN"
+
+The token defaults to $AC2_MCP_TOKEN. Serving on a non-loopback address
+requires a token. The unix socket is restricted to the current user.
+`,
+		RunE: runMCPServe,
+	}
+	cmd.Flags().StringVar(&mcpServeHTTP, "http", "", "listen address for HTTP/SSE transports (e.g. 127.0.0.1:7331)")
+	cmd.Flags().StringVar(&mcpServeUnix, "unix", "", "unix socket path")
+	cmd.Flags().StringVar(&mcpServeToken, "token", "", "bearer token required from HTTP clients (default $AC2_MCP_TOKEN)")
+	addConcurrencyFlags(cmd)
+	addOutputFlags(cmd)
+	return cmd
+}
+
+func runMCPServe(cmd *cobra.Command, args []string) error {
+	if mcpServeHTTP == "" && mcpServeUnix == "" {
+		return fmt.Errorf("at least one of --http or --unix is required")
+	}
+
+	_ = logger.Init("") // Ignore error, continue anyway
+	defer logger.Close()
+
+	token := mcpServeToken
+	if token == "" {
+		token = os.Getenv("AC2_MCP_TOKEN")
+	}
+	if mcpServeHTTP != "" && token == "" && !isLoopbackAddr(mcpServeHTTP) {
+		return fmt.Errorf("refusing to serve MCP on %s without a token; pass --token or bind to a loopback address", mcpServeHTTP)
+	}
+
+	det, err := detector.New()
+	if err != nil {
+		return err
+	}
+	agentPool := pool.NewAgentPool(det.GetAll(), "")
+	defer func() { _ = agentPool.Shutdown() }()
+	if err := applyConcurrencyLimits(agentPool); err != nil {
+		return err
+	}
+	if err := applyOutputBuffer(agentPool); err != nil {
+		return err
+	}
+
+	server := mcp.NewServer(agentPool)
+	server.SetAuthToken(token)
+
+	errCh := make(chan error, 2)
+	if mcpServeHTTP != "" {
+		listener, err := net.Listen("tcp", mcpServeHTTP)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", mcpServeHTTP, err)
+		}
+		go func() { errCh <- server.ServeHTTP(listener) }()
+		fmt.Printf("MCP streamable HTTP: %s/mcp\n", listenURL(listener.Addr()))
+		fmt.Printf("MCP SSE:             %s/mcp/sse\n", listenURL(listener.Addr()))
+	}
+	if mcpServeUnix != "" {
+		go func() { errCh <- server.ListenUnix(mcpServeUnix) }()
+		fmt.Printf("MCP unix socket:     %s\n", mcpServeUnix)
+	}
+	if token != "" {
+		fmt.Println("Auth: bearer token required")
+	} else {
+		fmt.Println("Auth: None (use --token or AC2_MCP_TOKEN)")
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	select {
+	case err := <-errCh:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	case sig := <-sigCh:
+		logger.Printf("MCP serve: received signal %v, shutting down", sig)
+	}
+	if mcpServeUnix != "" {
+		_ = os.Remove(mcpServeUnix)
+	}
+	return nil
+}
+
+// startEmbeddedMCP listens on addr for an in-process MCP server, so agents
+// launched by ac2 can call back into the same pool. It returns the base URL
+// handed to the pool and the token clients must present.
+func startEmbeddedMCP(addr, token string) (net.Listener, string, string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to listen on %s for MCP: %w", addr, err)
+	}
+	if token == "" {
+		token = newToken()
+	}
+	return listener, listenURL(listener.Addr()), token, nil
+}
+
+// serveEmbeddedMCP serves MCP for agentPool on a listener from startEmbeddedMCP.
+func serveEmbeddedMCP(agentPool *pool.AgentPool, listener net.Listener, token string) {
+	server := mcp.NewServer(agentPool)
+	server.SetAuthToken(token)
+	go func() {
+		if err := server.ServeHTTP(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Printf("MCP server error: %v", err)
+		}
+	}()
+}
+
+// listenURL returns the http URL for a listener, substituting loopback for
+// an unspecified host so local agents can reach it.
+func listenURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local
+// connections.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newToken returns a random 128-bit hex token.
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
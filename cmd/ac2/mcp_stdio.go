@@ -14,7 +14,7 @@ import (
 
 // getMCPStdioCmd returns the mcp-stdio subcommand
 func getMCPStdioCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "mcp-stdio",
 		Short: "Run ac2 as an MCP server over stdio (for Claude Code integration)",
 		Long: `Run ac2 as an MCP server using stdio transport.
@@ -31,6 +31,9 @@ Then you can use tools with slash commands like:
 `,
 		RunE: runMCPStdio,
 	}
+	addConcurrencyFlags(cmd)
+	addOutputFlags(cmd)
+	return cmd
 }
 
 func runMCPStdio(cmd *cobra.Command, args []string) error {
@@ -49,7 +52,10 @@ func runMCPStdio(cmd *cobra.Command, args []string) error {
 
 	// Initialize with all known agents so tools work immediately
 	// The pool will attempt to execute them by command name (e.g. "gemini")
-	det := detector.New()
+	det, err := detector.New()
+	if err != nil {
+		return err
+	}
 	available := det.GetAll()
 
 	// Do lazy detection in background just for logging/status updates
@@ -61,6 +67,14 @@ func runMCPStdio(cmd *cobra.Command, args []string) error {
 
 	// Create Agent Pool with all known agents
 	agentPool := pool.NewAgentPool(available, "")
+	if err := applyConcurrencyLimits(agentPool); err != nil {
+		return err
+	}
+	if err := applyOutputBuffer(agentPool); err != nil {
+		return err
+	}
+	// Stop agents kept alive for sessions when the client goes away
+	defer func() { _ = agentPool.Shutdown() }()
 
 	// Create MCP Server
 	mcpServer := mcp.NewServer(agentPool)
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/biliqiqi/ac2/internal/pool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	outputBufferSize string
+	outputLogDir     string
+)
+
+// addOutputFlags registers the per-instance output buffer flags on cmd.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputBufferSize, "output-buffer", "1M", "recent output kept in memory per agent instance (e.g. 512K, 4M)")
+	cmd.Flags().StringVar(&outputLogDir, "output-log-dir", "", "append output that no longer fits in the buffer to a per-instance log file in this directory")
+}
+
+// applyOutputBuffer configures agentPool from the output buffer flags.
+func applyOutputBuffer(agentPool *pool.AgentPool) error {
+	size, err := parseByteSize(outputBufferSize)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("invalid --output-buffer %q, expected a size such as 512K or 4M", outputBufferSize)
+	}
+	agentPool.SetOutputBuffer(size, outputLogDir)
+	return nil
+}
+
+// parseByteSize parses a byte count with an optional K, M or G suffix
+// (powers of 1024).
+func parseByteSize(value string) (int, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n > (1<<31-1)/multiplier {
+		return 0, fmt.Errorf("size too large")
+	}
+	return n * multiplier, nil
+}
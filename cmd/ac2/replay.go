@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/biliqiqi/ac2/internal/asciicast"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	replaySpeed     float64
+	replayIdleLimit float64
+)
+
+// getReplayCmd returns the replay subcommand
+func getReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <file.cast>",
+		Short: "Play back a recorded agent session in the terminal",
+		Long: `Play back an asciicast v2 recording made with --record-dir.
+
+Keys:
+    space   pause / resume
+    + / -   double / halve the speed
+    q       quit
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: runReplay,
+	}
+	cmd.Flags().Float64Var(&replaySpeed, "speed", 1, "playback speed multiplier")
+	cmd.Flags().Float64Var(&replayIdleLimit, "idle-limit", 2, "cap pauses between events to this many seconds (0 = keep original timing)")
+	return cmd
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	cast, err := asciicast.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	player := asciicast.NewPlayer(cast, asciicast.PlayerOptions{
+		Speed:     replaySpeed,
+		IdleLimit: replayIdleLimit,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil &&
+			(cols < cast.Header.Width || rows < cast.Header.Height) {
+			fmt.Printf("\033[33mWarning: recording is %dx%d but this terminal is %dx%d\033[0m\n",
+				cast.Header.Width, cast.Header.Height, cols, rows)
+		}
+
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = term.Restore(fd, oldState) }()
+		go readReplayKeys(player, cancel)
+	}
+
+	err = player.Run(ctx, asciicast.PlayerHandlers{
+		OnEvent: func(event asciicast.Event) {
+			if event.Code == asciicast.EventOutput {
+				_, _ = os.Stdout.WriteString(event.Data)
+			}
+		},
+	})
+	// Leave the cursor on a fresh line with attributes reset
+	_, _ = os.Stdout.WriteString("\033[0m\r\n")
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
+
+// readReplayKeys maps key presses to player controls until q or Ctrl+C.
+func readReplayKeys(player *asciicast.Player, quit func()) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range buf[:n] {
+			switch key {
+			case ' ':
+				player.TogglePause()
+			case '+', '=':
+				player.SetSpeed(player.Speed() * 2)
+			case '-', '_':
+				player.SetSpeed(player.Speed() / 2)
+			case 'q', 'Q', 3: // 3 is Ctrl+C in raw mode
+				quit()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/pool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restartPolicy string
+	restartMax    int
+	restartWindow time.Duration
+)
+
+// addRestartFlags registers the entry agent restart flags on cmd.
+func addRestartFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&restartPolicy, "restart", "", "restart the entry agent when it exits: never, on-failure or always (default from agents.toml, else never)")
+	cmd.Flags().IntVar(&restartMax, "restart-max", 0, "give up after this many restarts within --restart-window (default 5)")
+	cmd.Flags().DurationVar(&restartWindow, "restart-window", 0, "window for --restart-max (default 10m)")
+}
+
+// restartOption returns the entry agent option for the restart flags.
+func restartOption() (pool.AgentOption, error) {
+	policy := pool.RestartPolicy("")
+	if restartPolicy != "" {
+		parsed, err := pool.ParseRestartPolicy(restartPolicy)
+		if err != nil {
+			return nil, err
+		}
+		policy = parsed
+	}
+	return pool.WithRestart(pool.RestartConfig{
+		Policy:      policy,
+		MaxRestarts: restartMax,
+		Window:      restartWindow,
+	}), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/biliqiqi/ac2/internal/config"
+	"github.com/biliqiqi/ac2/internal/webterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tlsCert       string
+	tlsKey        string
+	tlsSelfSigned bool
+	tlsRegenerate bool
+)
+
+// addTLSFlags registers the web terminal HTTPS flags on cmd.
+func addTLSFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "serve the web terminal over HTTPS with this certificate file")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "private key file for --tls-cert")
+	cmd.Flags().BoolVar(&tlsSelfSigned, "tls-self-signed", false, "serve the web terminal over HTTPS with a self-signed certificate kept in the ac2 config dir")
+	cmd.Flags().BoolVar(&tlsRegenerate, "tls-regenerate", false, "replace the self-signed certificate, e.g. to cover new addresses of this machine")
+}
+
+// webTLS resolves the certificate and key to serve, generating a
+// self-signed pair if asked to. Empty files mean plain HTTP.
+func webTLS() (certFile, keyFile, fingerprint string, err error) {
+	switch {
+	case tlsSelfSigned && (tlsCert != "" || tlsKey != ""):
+		return "", "", "", fmt.Errorf("--tls-self-signed cannot be used with --tls-cert or --tls-key")
+	case tlsRegenerate && !tlsSelfSigned:
+		return "", "", "", fmt.Errorf("--tls-regenerate requires --tls-self-signed")
+	case (tlsCert == "") != (tlsKey == ""):
+		return "", "", "", fmt.Errorf("--tls-cert and --tls-key must be set together")
+	case tlsSelfSigned:
+		var missing []string
+		certFile, keyFile, missing, err = webterm.EnsureSelfSignedCert(filepath.Join(config.Dir(), "tls"), tlsRegenerate)
+		if err != nil {
+			return "", "", "", err
+		}
+		if len(missing) > 0 {
+			fmt.Printf("\033[33mWarning: the self-signed certificate does not cover %s; pass --tls-regenerate to replace it\033[0m\n\n",
+				strings.Join(missing, ", "))
+		}
+	case tlsCert != "":
+		certFile, keyFile = tlsCert, tlsKey
+	default:
+		return "", "", "", nil
+	}
+
+	fingerprint, err = webterm.CertFingerprint(certFile)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid TLS certificate: %w", err)
+	}
+	return certFile, keyFile, fingerprint, nil
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+// withUmask runs fn. Windows has no umask; unix sockets there are
+// protected by the ACL of their directory.
+func withUmask(mask int, fn func()) {
+	fn()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/webterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	webAuthFile   string
+	webToken      bool
+	webSessionTTL time.Duration
+)
+
+// addWebAuthFlags registers the web terminal login flags on cmd.
+func addWebAuthFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&webAuthFile, "web-auth-file", "", "web terminal accounts file with user:hash[:role] lines from `ac2 web-passwd` (default $AC2_WEB_AUTH)")
+	cmd.Flags().BoolVar(&webToken, "web-token", false, "require login even without accounts; the startup box prints a one-time login link")
+	cmd.Flags().DurationVar(&webSessionTTL, "web-session-ttl", webterm.DefaultSessionTTL, "how long a web terminal login lasts")
+}
+
+// loadWebAccounts reads the accounts from --web-auth-file, or from
+// $AC2_WEB_AUTH with lines separated by newlines or commas.
+func loadWebAccounts() ([]webterm.Account, string, error) {
+	if webAuthFile != "" {
+		data, err := os.ReadFile(webAuthFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read --web-auth-file: %w", err)
+		}
+		accounts, err := webterm.LoadAccounts(string(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid --web-auth-file %s: %w", webAuthFile, err)
+		}
+		return accounts, webAuthFile, nil
+	}
+	if env := os.Getenv("AC2_WEB_AUTH"); env != "" {
+		accounts, err := webterm.LoadAccounts(strings.ReplaceAll(env, ",", "\n"))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid AC2_WEB_AUTH: %w", err)
+		}
+		return accounts, "AC2_WEB_AUTH", nil
+	}
+	return nil, "", nil
+}
+
+// hasOperatorAccount reports whether someone can log in as an operator.
+func hasOperatorAccount(accounts []webterm.Account) bool {
+	for _, account := range accounts {
+		if account.Role == webterm.RoleOperator {
+			return true
+		}
+	}
+	return false
+}
+
+// getWebPasswdCmd returns the web-passwd subcommand.
+func getWebPasswdCmd() *cobra.Command {
+	var role string
+	cmd := &cobra.Command{
+		Use:   "web-passwd USER",
+		Short: "Print a web terminal accounts file line with a hashed password",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user := args[0]
+			if user == "" || strings.Contains(user, ":") {
+				return fmt.Errorf("invalid user %q", user)
+			}
+			if webterm.Role(role) != webterm.RoleOperator && webterm.Role(role) != webterm.RoleViewer {
+				return fmt.Errorf("unknown role %q, expected operator or viewer", role)
+			}
+			pass, err := readNewPassword()
+			if err != nil {
+				return err
+			}
+			hash, err := webterm.HashPassword(pass)
+			if err != nil {
+				return err
+			}
+			line := user + ":" + hash
+			if webterm.Role(role) == webterm.RoleViewer {
+				line += ":" + role
+			}
+			fmt.Println(line)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&role, "role", string(webterm.RoleOperator), "account role: operator or viewer")
+	return cmd
+}
+
+// readNewPassword asks for a password twice on a terminal, or reads one line
+// from piped stdin.
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		pass := strings.TrimRight(line, "\r\n")
+		if pass == "" {
+			return "", fmt.Errorf("no password on stdin: %v", err)
+		}
+		return pass, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", fmt.Errorf("empty password")
+	}
+	if string(pass) != string(again) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(pass), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// webBindLoopback binds the web terminal to 127.0.0.1.
+	webBindLoopback = "loopback"
+	// webBindUnixPrefix marks a unix socket path in --web-bind.
+	webBindUnixPrefix = "unix:"
+)
+
+var (
+	webBind         string
+	webInsecureBind bool
+	webSocketGroup  string
+)
+
+// addWebBindFlags registers the web terminal listen address flags on cmd.
+func addWebBindFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&webBind, "web-bind", webBindLoopback, "web terminal address: loopback, an IP such as 0.0.0.0 or 192.168.1.5, or unix:/path/to/socket")
+	cmd.Flags().BoolVar(&webInsecureBind, "web-insecure-bind", false, "allow --web-bind on a non-loopback address without authentication")
+	cmd.Flags().StringVar(&webSocketGroup, "web-socket-group", "", "let this group connect to the --web-bind unix socket, e.g. a reverse proxy's")
+}
+
+// listenWeb listens on the --web-bind address. TCP addresses try up to
+// retries ports from port on; the returned port is the one in use.
+func listenWeb(bind string, port, retries int) (net.Listener, int, error) {
+	if path, ok := strings.CutPrefix(bind, webBindUnixPrefix); ok {
+		listener, err := listenWebUnix(path, webSocketGroup)
+		return listener, 0, err
+	}
+	if webSocketGroup != "" {
+		return nil, 0, fmt.Errorf("--web-socket-group requires --web-bind unix:PATH")
+	}
+
+	host := bind
+	if host == webBindLoopback {
+		host = "127.0.0.1"
+	}
+	if host != "localhost" && net.ParseIP(host) == nil {
+		return nil, 0, fmt.Errorf("invalid --web-bind %q, expected loopback, an IP address or unix:PATH", bind)
+	}
+	for i := 0; i < retries; i++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port+i)))
+		if err == nil {
+			return listener, port + i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("no available port found on %s from %d to %d", host, port, port+retries-1)
+}
+
+// listenWebUnix listens on a unix socket that only its owner, and group
+// if one is given, may connect to, e.g. a reverse proxy or an SSH forward.
+func listenWebUnix(path, group string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--web-bind unix: needs a socket path")
+	}
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --web-socket-group: %w", err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, fmt.Errorf("invalid --web-socket-group: group ID %q is not numeric", g.Gid)
+		}
+	}
+	// Replace a socket left behind by an earlier run, but nothing else
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+
+	// The socket is created owner-only, so nobody else can connect before
+	// the group is set
+	var listener net.Listener
+	var err error
+	withUmask(0o177, func() {
+		listener, err = net.Listen("unix", path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket %s: %w", path, err)
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to set the unix socket group: %w", err)
+		}
+		err = os.Chmod(path, 0o660)
+	} else {
+		err = os.Chmod(path, 0o600)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to restrict unix socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// isLocalWebBind reports whether a --web-bind address only accepts
+// connections from this machine.
+func isLocalWebBind(bind string) bool {
+	if bind == webBindLoopback || strings.HasPrefix(bind, webBindUnixPrefix) {
+		return true
+	}
+	return isLoopbackAddr(net.JoinHostPort(bind, "0"))
+}
+
+// webBaseURL returns the address users open for a web terminal listener.
+func webBaseURL(scheme string, listener net.Listener) string {
+	if listener.Addr().Network() == "unix" {
+		return webBindUnixPrefix + listener.Addr().String()
+	}
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return scheme + "://" + listener.Addr().String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// webLink returns the link to path on the web terminal. Unix socket
+// listeners have no URL of their own, so only the path is shown.
+func webLink(base, path string) string {
+	if strings.HasPrefix(base, webBindUnixPrefix) {
+		return path
+	}
+	return base + path
+}
@@ -3,6 +3,7 @@ module github.com/biliqiqi/ac2
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/creack/pty v1.1.24
 	github.com/gdamore/tcell/v2 v2.8.1
 	github.com/gorilla/websocket v1.5.1
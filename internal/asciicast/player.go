@@ -0,0 +1,282 @@
+package asciicast
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlayerOptions configures playback.
+type PlayerOptions struct {
+	// Speed multiplies playback speed; zero means 1.
+	Speed float64
+	// IdleLimit caps pauses between events, in seconds; zero keeps them.
+	IdleLimit float64
+	// HoldAtEnd keeps Run alive after the last event, paused, so the
+	// recording can be sought again.
+	HoldAtEnd bool
+}
+
+// PlayerHandlers receive playback output. All are optional and called from
+// the goroutine running Run.
+type PlayerHandlers struct {
+	// OnEvent receives output, resize and marker events. Input events are
+	// not replayed.
+	OnEvent func(Event)
+	// OnSeek is called before the screen is rebuilt for a new position; the
+	// events up to that position follow through OnEvent.
+	OnSeek func()
+	// OnState reports position changes and pause/speed updates.
+	OnState func(PlayerState)
+}
+
+// PlayerState is a snapshot of playback progress.
+type PlayerState struct {
+	Position float64
+	Duration float64
+	Speed    float64
+	Paused   bool
+	Ended    bool
+}
+
+// Player replays a Cast in real time with pause, speed and seek controls.
+// Control methods may be called from any goroutine.
+type Player struct {
+	cast *Cast
+	opts PlayerOptions
+
+	mu     sync.Mutex
+	pos    float64
+	next   int
+	speed  float64
+	paused bool
+	seekTo float64
+	seek   bool
+	wake   chan struct{}
+}
+
+// stateInterval is how often OnState reports progress while playing.
+const stateInterval = 250 * time.Millisecond
+
+// NewPlayer returns a player positioned at the start of cast.
+func NewPlayer(cast *Cast, opts PlayerOptions) *Player {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	return &Player{
+		cast:  cast,
+		opts:  opts,
+		speed: speed,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// TogglePause pauses or resumes playback.
+func (p *Player) TogglePause() {
+	p.mu.Lock()
+	p.paused = !p.paused
+	p.mu.Unlock()
+	p.signal()
+}
+
+// SetPaused pauses or resumes playback.
+func (p *Player) SetPaused(paused bool) {
+	p.mu.Lock()
+	p.paused = paused
+	p.mu.Unlock()
+	p.signal()
+}
+
+// SetSpeed changes the playback speed multiplier.
+func (p *Player) SetSpeed(speed float64) {
+	if speed <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.speed = speed
+	p.mu.Unlock()
+	p.signal()
+}
+
+// Speed returns the current playback speed multiplier.
+func (p *Player) Speed() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speed
+}
+
+// Seek moves playback to position seconds into the recording.
+func (p *Player) Seek(position float64) {
+	p.mu.Lock()
+	p.seekTo = position
+	p.seek = true
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *Player) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run plays the recording until it ends (unless HoldAtEnd is set) or ctx is
+// done.
+func (p *Player) Run(ctx context.Context, h PlayerHandlers) error {
+	ticker := time.NewTicker(stateInterval)
+	defer ticker.Stop()
+
+	events := p.cast.Events
+	if resize := p.initialSize(); resize.Data != "" {
+		p.emit(h, resize)
+	}
+	p.report(h, false)
+
+	for {
+		p.mu.Lock()
+		if p.seek {
+			p.seek = false
+			target := p.seekTo
+			p.mu.Unlock()
+			p.rebuild(h, target)
+			p.report(h, false)
+			continue
+		}
+
+		ended := p.next >= len(events)
+		if ended && !p.opts.HoldAtEnd {
+			p.mu.Unlock()
+			p.report(h, true)
+			return nil
+		}
+		if ended || p.paused {
+			p.mu.Unlock()
+			p.report(h, ended)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-p.wake:
+			}
+			continue
+		}
+
+		event := events[p.next]
+		gap := event.Time - p.pos
+		if p.opts.IdleLimit > 0 && gap > p.opts.IdleLimit {
+			p.pos = event.Time - p.opts.IdleLimit
+			gap = p.opts.IdleLimit
+		}
+		speed := p.speed
+		p.mu.Unlock()
+
+		started := time.Now()
+		timer := time.NewTimer(time.Duration(gap / speed * float64(time.Second)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			p.mu.Lock()
+			p.pos = event.Time
+			p.next++
+			p.mu.Unlock()
+			p.emit(h, event)
+		case <-p.wake:
+			timer.Stop()
+			p.advance(started, speed, event.Time)
+		case <-ticker.C:
+			timer.Stop()
+			p.advance(started, speed, event.Time)
+			p.report(h, false)
+		}
+	}
+}
+
+// advance moves the position by the wall time spent waiting, without
+// passing the event that was being waited for.
+func (p *Player) advance(started time.Time, speed, limit float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pos += time.Since(started).Seconds() * speed
+	if p.pos > limit {
+		p.pos = limit
+	}
+}
+
+// rebuild replays every event before target at once, merging consecutive
+// output so clients redraw quickly.
+func (p *Player) rebuild(h PlayerHandlers, target float64) {
+	events := p.cast.Events
+	if target < 0 {
+		target = 0
+	}
+	if duration := p.cast.Duration(); target > duration {
+		target = duration
+	}
+
+	if h.OnSeek != nil {
+		h.OnSeek()
+	}
+	if resize := p.initialSize(); resize.Data != "" {
+		p.emit(h, resize)
+	}
+
+	var output strings.Builder
+	flush := func(at float64) {
+		if output.Len() > 0 {
+			p.emit(h, Event{Time: at, Code: EventOutput, Data: output.String()})
+			output.Reset()
+		}
+	}
+	next := 0
+	for ; next < len(events) && events[next].Time <= target; next++ {
+		event := events[next]
+		switch event.Code {
+		case EventOutput:
+			output.WriteString(event.Data)
+		case EventResize:
+			flush(event.Time)
+			p.emit(h, event)
+		}
+	}
+	flush(target)
+
+	p.mu.Lock()
+	p.pos = target
+	p.next = next
+	p.mu.Unlock()
+}
+
+func (p *Player) initialSize() Event {
+	header := p.cast.Header
+	if header.Width <= 0 || header.Height <= 0 {
+		return Event{}
+	}
+	return Event{Code: EventResize, Data: formatSize(header.Width, header.Height)}
+}
+
+func (p *Player) emit(h PlayerHandlers, event Event) {
+	if event.Code == EventInput || h.OnEvent == nil {
+		return
+	}
+	h.OnEvent(event)
+}
+
+func (p *Player) report(h PlayerHandlers, ended bool) {
+	if h.OnState == nil {
+		return
+	}
+	p.mu.Lock()
+	state := PlayerState{
+		Position: p.pos,
+		Duration: p.cast.Duration(),
+		Speed:    p.speed,
+		Paused:   p.paused,
+		Ended:    ended,
+	}
+	p.mu.Unlock()
+	h.OnState(state)
+}
@@ -0,0 +1,87 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Event is one timed event of a recording.
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// Cast is a recording loaded into memory.
+type Cast struct {
+	Header Header
+	Events []Event
+}
+
+// Duration returns the time of the last event in seconds.
+func (c *Cast) Duration() float64 {
+	if len(c.Events) == 0 {
+		return 0
+	}
+	return c.Events[len(c.Events)-1].Time
+}
+
+// Open reads the asciicast v2 file at path.
+func Open(path string) (*Cast, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	return Read(file)
+}
+
+// Read parses an asciicast v2 stream. A truncated last line, as left by an
+// interrupted recording, is ignored.
+func Read(r io.Reader) (*Cast, error) {
+	reader := bufio.NewReader(r)
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read asciicast header: %w", err)
+	}
+	var cast Cast
+	if err := json.Unmarshal(line, &cast.Header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if cast.Header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d", cast.Header.Version)
+	}
+
+	for lineNo := 2; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var raw []any
+			if jsonErr := json.Unmarshal(line, &raw); jsonErr != nil || len(raw) != 3 {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("invalid asciicast event on line %d", lineNo)
+			}
+			t, okTime := raw[0].(float64)
+			code, okCode := raw[1].(string)
+			data, okData := raw[2].(string)
+			if !okTime || !okCode || !okData {
+				return nil, fmt.Errorf("invalid asciicast event on line %d", lineNo)
+			}
+			cast.Events = append(cast.Events, Event{Time: t, Code: code, Data: data})
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &cast, nil
+}
@@ -0,0 +1,172 @@
+package asciicast
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Event codes used in asciicast v2 event lines.
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventResize = "r"
+	EventMarker = "m"
+)
+
+// Header is the first line of an asciicast v2 file
+// (https://docs.asciinema.org/manual/asciicast/v2/).
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder appends timed events to an asciicast v2 file. It is safe for
+// concurrent use; each event is written with a single write call so a
+// recording stays readable if ac2 dies mid-session.
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	start  time.Time
+	closed bool
+
+	// Trailing bytes of an incomplete UTF-8 sequence, per stream
+	pendingOutput []byte
+	pendingInput  []byte
+}
+
+// Create creates path (and its directory) and writes the header.
+// Version and Timestamp are filled in when zero.
+func Create(path string, header Header) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	start := time.Now()
+	if header.Version == 0 {
+		header.Version = 2
+	}
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+	line, err := json.Marshal(header)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to write recording header: %w", err)
+	}
+
+	return &Recorder{file: file, start: start}, nil
+}
+
+// Output records data written by the program to the terminal.
+func (r *Recorder) Output(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pendingOutput = r.writeText(EventOutput, r.pendingOutput, data)
+}
+
+// Input records data typed into the program.
+func (r *Recorder) Input(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pendingInput = r.writeText(EventInput, r.pendingInput, data)
+}
+
+// Resize records a terminal size change.
+func (r *Recorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent(EventResize, formatSize(cols, rows))
+}
+
+// Marker records a named marker, e.g. an agent restart.
+func (r *Recorder) Marker(label string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent(EventMarker, label)
+}
+
+// Close flushes pending bytes and closes the file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	if len(r.pendingOutput) > 0 {
+		r.writeEvent(EventOutput, string(r.pendingOutput))
+	}
+	if len(r.pendingInput) > 0 {
+		r.writeEvent(EventInput, string(r.pendingInput))
+	}
+	r.closed = true
+	return r.file.Close()
+}
+
+// writeText writes pending+data up to the last complete UTF-8 sequence and
+// returns the incomplete remainder, since chunks from a PTY may split runes.
+func (r *Recorder) writeText(code string, pending, data []byte) []byte {
+	buf := append(pending, data...)
+	cut := completePrefix(buf)
+	if cut > 0 {
+		r.writeEvent(code, string(buf[:cut]))
+	}
+	return append([]byte(nil), buf[cut:]...)
+}
+
+func (r *Recorder) writeEvent(code, data string) {
+	if r.closed {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]any{elapsed, code, data})
+	if err != nil {
+		return
+	}
+	_, _ = r.file.Write(append(line, '\n'))
+}
+
+func formatSize(cols, rows int) string {
+	return fmt.Sprintf("%dx%d", cols, rows)
+}
+
+// ParseSize parses the "COLSxROWS" data of a resize event.
+func ParseSize(data string) (cols, rows int, ok bool) {
+	if _, err := fmt.Sscanf(data, "%dx%d", &cols, &rows); err != nil || cols <= 0 || rows <= 0 {
+		return 0, 0, false
+	}
+	return cols, rows, true
+}
+
+// completePrefix returns the length of buf without a trailing incomplete
+// UTF-8 sequence. Invalid bytes are kept; JSON encoding replaces them.
+func completePrefix(buf []byte) int {
+	for i := 1; i <= utf8.UTFMax && i <= len(buf); i++ {
+		start := len(buf) - i
+		if !utf8.RuneStart(buf[start]) {
+			continue
+		}
+		if !utf8.FullRune(buf[start:]) {
+			return start
+		}
+		break
+	}
+	return len(buf)
+}
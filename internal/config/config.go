@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Dir returns the ac2 configuration directory.
+// It honors AC2_CONFIG_DIR and XDG_CONFIG_HOME, falling back to ~/.config/ac2.
+func Dir() string {
+	if dir := os.Getenv("AC2_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "ac2")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ac2"
+	}
+	return filepath.Join(home, ".config", "ac2")
+}
+
+// Path joins name onto the ac2 configuration directory.
+func Path(name string) string {
+	return filepath.Join(Dir(), name)
+}
@@ -0,0 +1,226 @@
+package control
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/biliqiqi/ac2/internal/pool"
+	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
+)
+
+// stopTimeout bounds how long an action waits for a stopped agent to exit.
+const stopTimeout = 3 * time.Second
+
+// Controller tracks the current and main agent and carries out the agent
+// control actions shared by the local control mode and the web terminal.
+type Controller struct {
+	agentPool *pool.AgentPool
+
+	// op serializes actions, so exit watchers can wait for one to finish.
+	op sync.Mutex
+
+	mu        sync.Mutex
+	main      *pool.AgentInstance
+	current   *pool.AgentInstance
+	switching bool
+	attached  []func(*pool.AgentInstance)
+	quit      func()
+}
+
+func New(agentPool *pool.AgentPool, mainAgent *pool.AgentInstance) *Controller {
+	return &Controller{
+		agentPool: agentPool,
+		main:      mainAgent,
+		current:   mainAgent,
+	}
+}
+
+// OnAttach registers fn to route terminal I/O to a newly current agent.
+// Handlers run in registration order.
+func (c *Controller) OnAttach(fn func(agent *pool.AgentInstance)) {
+	c.mu.Lock()
+	c.attached = append(c.attached, fn)
+	c.mu.Unlock()
+}
+
+// SetQuitHandler sets the function that shuts ac2 down on Quit.
+func (c *Controller) SetQuitHandler(fn func()) {
+	c.mu.Lock()
+	c.quit = fn
+	c.mu.Unlock()
+}
+
+// Main returns the entry agent.
+func (c *Controller) Main() *pool.AgentInstance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.main
+}
+
+// Current returns the agent that terminals without a pinned agent follow.
+func (c *Controller) Current() *pool.AgentInstance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+// Switching reports whether an action is stopping or replacing an agent.
+func (c *Controller) Switching() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.switching
+}
+
+// Settle waits for an action in progress and reports whether agent is
+// still the current and the main agent. Exit watchers use it to ignore
+// agents that an action stopped on purpose.
+func (c *Controller) Settle(agent *pool.AgentInstance) (current, main bool) {
+	c.op.Lock()
+	defer c.op.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current == agent, c.main == agent
+}
+
+// Switch makes a running instance current. The previous one keeps running
+// in the background.
+func (c *Controller) Switch(agentID string) (*pool.AgentInstance, error) {
+	c.op.Lock()
+	defer c.op.Unlock()
+
+	agent, err := c.agentPool.Get(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if agent.Status() != pool.StatusRunning {
+		return nil, fmt.Errorf("agent %s is not running", agentID)
+	}
+	c.attach(agent)
+	return agent, nil
+}
+
+// Replace stops the current agent and makes the oldest running instance of
+// agentType current, starting one if none is running.
+func (c *Controller) Replace(agentType string) (*pool.AgentInstance, error) {
+	c.op.Lock()
+	defer c.op.Unlock()
+	c.setSwitching(true)
+	defer c.setSwitching(false)
+
+	previous := c.Current()
+	if previous != nil {
+		logger.Printf("Control: stopping current agent %s", previous.ID)
+		c.stopAndWait(previous)
+	}
+
+	logger.Printf("Control: starting %s agent", agentType)
+	agent, err := c.agentPool.GetOrCreate(agentType)
+	if err != nil {
+		return nil, err
+	}
+	c.replaced(previous, agent)
+	c.attach(agent)
+	return agent, nil
+}
+
+// Start starts a new instance and makes it current.
+func (c *Controller) Start(agentType string, opts ...pool.AgentOption) (*pool.AgentInstance, error) {
+	c.op.Lock()
+	defer c.op.Unlock()
+
+	agent, err := c.agentPool.Create(agentType, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.attach(agent)
+	return agent, nil
+}
+
+// Restart stops an instance if it is still running and starts a new one
+// with the same launch options in its place, e.g. for an agent that
+// crashed or whose restart policy gave up.
+func (c *Controller) Restart(agentID string) (*pool.AgentInstance, error) {
+	c.op.Lock()
+	defer c.op.Unlock()
+
+	previous, err := c.agentPool.Get(agentID)
+	if err != nil {
+		return nil, err
+	}
+	c.setSwitching(true)
+	defer c.setSwitching(false)
+
+	logger.Printf("Control: restarting agent %s", agentID)
+	c.stopAndWait(previous)
+	agent, err := c.agentPool.Relaunch(agentID)
+	if err != nil {
+		return nil, err
+	}
+	c.replaced(previous, agent)
+	if c.Current() == previous {
+		c.attach(agent)
+	}
+	return agent, nil
+}
+
+// Quit shuts ac2 down.
+func (c *Controller) Quit() {
+	c.mu.Lock()
+	quit := c.quit
+	c.mu.Unlock()
+	if quit != nil {
+		quit()
+	}
+}
+
+func (c *Controller) setSwitching(switching bool) {
+	c.mu.Lock()
+	c.switching = switching
+	c.mu.Unlock()
+}
+
+// replaced moves the main agent to agent when previous was the main agent.
+// The current agent moves when agent is attached.
+func (c *Controller) replaced(previous, agent *pool.AgentInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if previous != nil && c.main == previous {
+		logger.Printf("Control: main agent is now %s", agent.ID)
+		c.main = agent
+	}
+}
+
+// attach makes agent current and runs the attach handlers. Callers must
+// hold c.op.
+func (c *Controller) attach(agent *pool.AgentInstance) {
+	c.mu.Lock()
+	c.current = agent
+	handlers := append([]func(*pool.AgentInstance){}, c.attached...)
+	c.mu.Unlock()
+
+	logger.Printf("Switched to agent: %s", agent.ID)
+	for _, fn := range handlers {
+		fn(agent)
+	}
+}
+
+// stopAndWait stops agent through the pool, so it is marked stopped right
+// away (no reuse when starting the same type) and its restart policy does
+// not bring it back, then waits for its process to exit.
+func (c *Controller) stopAndWait(agent *pool.AgentInstance) {
+	proxy := agent.Proxy()
+	_ = c.agentPool.Stop(agent.ID)
+	if proxy == nil {
+		return
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for proxy.Status() != ptyproxy.StatusStopped {
+		if time.Now().After(deadline) {
+			logger.Printf("Control: timed out waiting for agent %s to stop", agent.ID)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
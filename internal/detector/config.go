@@ -0,0 +1,238 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/biliqiqi/ac2/internal/config"
+)
+
+// agentsFile is the on-disk layout of agents.toml:
+//
+//	[[agent]]
+//	type = "aider"
+//	name = "Aider"
+//	command = "aider"
+//	args = ["--no-auto-commits"]
+//	env = { AIDER_DARK_MODE = "true" }
+//	version_flag = "--version"
+//	non_interactive_args = ["--message", "{message}", "--yes"]
+//	session_start_args = ["--session", "{session}"]
+//	session_resume_args = ["--session", "{session}"]
+//	stream_args = ["--output-format", "stream-json", "--verbose"]
+//	output_format = "claude-stream-json"
+//	ready_patterns = ['(?m)^> $']
+//	busy_patterns = ['esc to interrupt']
+//	restart = "on-failure"
+//	restart_max = 5
+//	restart_window = "10m"
+type agentsFile struct {
+	Agents []agentConfig `toml:"agent"`
+}
+
+type agentConfig struct {
+	Type               string            `toml:"type"`
+	Name               string            `toml:"name"`
+	Command            string            `toml:"command"`
+	Args               []string          `toml:"args"`
+	Env                map[string]string `toml:"env"`
+	VersionFlag        string            `toml:"version_flag"`
+	NonInteractiveArgs []string          `toml:"non_interactive_args"`
+	SessionStartArgs   []string          `toml:"session_start_args"`
+	SessionResumeArgs  []string          `toml:"session_resume_args"`
+	StreamArgs         []string          `toml:"stream_args"`
+	OutputFormat       string            `toml:"output_format"`
+	ReadyPatterns      []string          `toml:"ready_patterns"`
+	BusyPatterns       []string          `toml:"busy_patterns"`
+	Restart            string            `toml:"restart"`
+	RestartMax         int               `toml:"restart_max"`
+	RestartWindow      string            `toml:"restart_window"`
+}
+
+var agentTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ConfigPath returns the agents config file location.
+// AC2_AGENTS_CONFIG overrides the default under the ac2 config directory.
+func ConfigPath() string {
+	if path := os.Getenv("AC2_AGENTS_CONFIG"); path != "" {
+		return path
+	}
+	return config.Path("agents.toml")
+}
+
+// LoadConfig reads user-defined agents from path.
+// A missing file is not an error and yields no agents.
+func LoadConfig(path string) ([]AgentInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read agents config: %w", err)
+	}
+
+	var file agentsFile
+	meta, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse agents config %s: %w", path, err)
+	}
+	// Misspelled keys would otherwise be dropped without a trace
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("agents config %s: unknown key %q", path, undecoded[0].String())
+	}
+
+	agents := make([]AgentInfo, 0, len(file.Agents))
+	seen := make(map[string]bool)
+	for i, cfg := range file.Agents {
+		if !agentTypePattern.MatchString(cfg.Type) {
+			return nil, fmt.Errorf("agents config %s: agent #%d has invalid type %q (use lowercase letters, digits, '-' or '_')", path, i+1, cfg.Type)
+		}
+		switch cfg.OutputFormat {
+		case OutputText, OutputClaudeStreamJSON, OutputCodexJSON:
+		default:
+			return nil, fmt.Errorf("agents config %s: agent %q has unknown output_format %q", path, cfg.Type, cfg.OutputFormat)
+		}
+		for _, pattern := range slices.Concat(cfg.ReadyPatterns, cfg.BusyPatterns) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("agents config %s: agent %q has invalid pattern %q: %w", path, cfg.Type, pattern, err)
+			}
+		}
+		switch cfg.Restart {
+		case "", RestartNever, RestartOnFailure, RestartAlways:
+		default:
+			return nil, fmt.Errorf("agents config %s: agent %q has unknown restart policy %q (use never, on-failure or always)", path, cfg.Type, cfg.Restart)
+		}
+		if cfg.RestartMax < 0 {
+			return nil, fmt.Errorf("agents config %s: agent %q has negative restart_max", path, cfg.Type)
+		}
+		var restartWindow time.Duration
+		if cfg.RestartWindow != "" {
+			window, err := time.ParseDuration(cfg.RestartWindow)
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("agents config %s: agent %q has invalid restart_window %q", path, cfg.Type, cfg.RestartWindow)
+			}
+			restartWindow = window
+		}
+		if seen[cfg.Type] {
+			return nil, fmt.Errorf("agents config %s: duplicate agent type %q", path, cfg.Type)
+		}
+		seen[cfg.Type] = true
+
+		agents = append(agents, AgentInfo{
+			Type:               AgentType(cfg.Type),
+			Name:               cfg.Name,
+			Command:            cfg.Command,
+			Args:               cfg.Args,
+			Env:                envList(cfg.Env),
+			VersionFlag:        cfg.VersionFlag,
+			NonInteractiveArgs: cfg.NonInteractiveArgs,
+			SessionStartArgs:   cfg.SessionStartArgs,
+			SessionResumeArgs:  cfg.SessionResumeArgs,
+			StreamArgs:         cfg.StreamArgs,
+			OutputFormat:       cfg.OutputFormat,
+			ReadyPatterns:      cfg.ReadyPatterns,
+			BusyPatterns:       cfg.BusyPatterns,
+			Restart:            cfg.Restart,
+			RestartMax:         cfg.RestartMax,
+			RestartWindow:      restartWindow,
+		})
+	}
+	return agents, nil
+}
+
+// mergeAgents overlays user definitions on the built-in agents.
+// A user agent with a built-in type only replaces the fields it sets.
+func mergeAgents(builtin, custom []AgentInfo) []AgentInfo {
+	merged := make([]AgentInfo, len(builtin))
+	copy(merged, builtin)
+
+	for _, agent := range custom {
+		idx := -1
+		for i := range merged {
+			if merged[i].Type == agent.Type {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			if agent.Name == "" {
+				agent.Name = string(agent.Type)
+			}
+			if agent.Command == "" {
+				agent.Command = string(agent.Type)
+			}
+			merged = append(merged, agent)
+			continue
+		}
+
+		base := &merged[idx]
+		if agent.Name != "" {
+			base.Name = agent.Name
+		}
+		if agent.Command != "" {
+			base.Command = agent.Command
+		}
+		if agent.Args != nil {
+			base.Args = agent.Args
+		}
+		if agent.Env != nil {
+			base.Env = agent.Env
+		}
+		if agent.VersionFlag != "" {
+			base.VersionFlag = agent.VersionFlag
+		}
+		if agent.NonInteractiveArgs != nil {
+			base.NonInteractiveArgs = agent.NonInteractiveArgs
+		}
+		if agent.SessionStartArgs != nil {
+			base.SessionStartArgs = agent.SessionStartArgs
+		}
+		if agent.SessionResumeArgs != nil {
+			base.SessionResumeArgs = agent.SessionResumeArgs
+		}
+		if agent.StreamArgs != nil {
+			base.StreamArgs = agent.StreamArgs
+			base.OutputFormat = agent.OutputFormat
+		}
+		if agent.ReadyPatterns != nil {
+			base.ReadyPatterns = agent.ReadyPatterns
+		}
+		if agent.BusyPatterns != nil {
+			base.BusyPatterns = agent.BusyPatterns
+		}
+		if agent.Restart != "" {
+			base.Restart = agent.Restart
+		}
+		if agent.RestartMax != 0 {
+			base.RestartMax = agent.RestartMax
+		}
+		if agent.RestartWindow != 0 {
+			base.RestartWindow = agent.RestartWindow
+		}
+	}
+	return merged
+}
+
+func envList(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]string, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, key+"="+env[key])
+	}
+	return list
+}
@@ -0,0 +1,156 @@
+package detector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agents.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    []AgentInfo
+		wantErr string
+	}{
+		{
+			name: "full agent",
+			config: `
+[[agent]]
+type = "aider"
+name = "Aider"
+command = "aider"
+args = ["--no-auto-commits"]
+env = { B = "2", A = "1" }
+non_interactive_args = ["--message", "{message}"]
+ready_patterns = ['(?m)^> $']
+restart = "on-failure"
+restart_max = 3
+restart_window = "5m"
+`,
+			want: []AgentInfo{{
+				Type:               "aider",
+				Name:               "Aider",
+				Command:            "aider",
+				Args:               []string{"--no-auto-commits"},
+				Env:                []string{"A=1", "B=2"},
+				NonInteractiveArgs: []string{"--message", "{message}"},
+				ReadyPatterns:      []string{`(?m)^> $`},
+				Restart:            RestartOnFailure,
+				RestartMax:         3,
+				RestartWindow:      5 * time.Minute,
+			}},
+		},
+		{name: "empty file", config: "", want: []AgentInfo{}},
+		{name: "syntax error", config: "[[agent]\ntype = \"x\"", wantErr: "failed to parse"},
+		{name: "uppercase type", config: "[[agent]]\ntype = \"Aider\"", wantErr: "invalid type"},
+		{name: "missing type", config: "[[agent]]\nname = \"Aider\"", wantErr: "invalid type"},
+		{name: "unknown key", config: "[[agent]]\ntype = \"aider\"\ncomand = \"aider\"", wantErr: `unknown key "agent.comand"`},
+		{name: "unknown output format", config: "[[agent]]\ntype = \"aider\"\noutput_format = \"xml\"", wantErr: "unknown output_format"},
+		{name: "invalid pattern", config: "[[agent]]\ntype = \"aider\"\nbusy_patterns = ['(']", wantErr: "invalid pattern"},
+		{name: "unknown restart policy", config: "[[agent]]\ntype = \"aider\"\nrestart = \"sometimes\"", wantErr: "unknown restart policy"},
+		{name: "negative restart max", config: "[[agent]]\ntype = \"aider\"\nrestart_max = -1", wantErr: "negative restart_max"},
+		{name: "invalid restart window", config: "[[agent]]\ntype = \"aider\"\nrestart_window = \"soon\"", wantErr: "invalid restart_window"},
+		{name: "duplicate type", config: "[[agent]]\ntype = \"aider\"\n[[agent]]\ntype = \"aider\"", wantErr: "duplicate agent type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadConfig(writeConfig(t, tt.config))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("LoadConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	agents, err := LoadConfig(filepath.Join(t.TempDir(), "agents.toml"))
+	if err != nil || agents != nil {
+		t.Fatalf("LoadConfig() = %v, %v; want no agents and no error", agents, err)
+	}
+}
+
+func TestNewFailsOnInvalidConfig(t *testing.T) {
+	t.Setenv("AC2_AGENTS_CONFIG", writeConfig(t, "[[agent]]\ntype = \"Bad Type\""))
+	if _, err := New(); err == nil {
+		t.Fatal("New() accepted an invalid agents config")
+	}
+}
+
+func TestMergeAgents(t *testing.T) {
+	builtin := []AgentInfo{{
+		Type:               "claude",
+		Name:               "Claude Code",
+		Command:            "claude",
+		NonInteractiveArgs: []string{"-p", "{message}"},
+		StreamArgs:         []string{"--output-format", "stream-json"},
+		OutputFormat:       OutputClaudeStreamJSON,
+	}}
+	tests := []struct {
+		name   string
+		custom []AgentInfo
+		want   []AgentInfo
+	}{
+		{
+			name:   "new agent defaults name and command to its type",
+			custom: []AgentInfo{{Type: "aider"}},
+			want:   append(builtin[:1:1], AgentInfo{Type: "aider", Name: "aider", Command: "aider"}),
+		},
+		{
+			name:   "override keeps unset fields",
+			custom: []AgentInfo{{Type: "claude", Command: "/opt/claude", Args: []string{"--model", "opus"}}},
+			want: []AgentInfo{{
+				Type:               "claude",
+				Name:               "Claude Code",
+				Command:            "/opt/claude",
+				Args:               []string{"--model", "opus"},
+				NonInteractiveArgs: []string{"-p", "{message}"},
+				StreamArgs:         []string{"--output-format", "stream-json"},
+				OutputFormat:       OutputClaudeStreamJSON,
+			}},
+		},
+		{
+			name:   "stream args replace the output format with them",
+			custom: []AgentInfo{{Type: "claude", StreamArgs: []string{}}},
+			want: []AgentInfo{{
+				Type:               "claude",
+				Name:               "Claude Code",
+				Command:            "claude",
+				NonInteractiveArgs: []string{"-p", "{message}"},
+				StreamArgs:         []string{},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeAgents(builtin, tt.custom)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mergeAgents() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if builtin[0].Command != "claude" {
+		t.Fatal("mergeAgents modified the built-in agents")
+	}
+}
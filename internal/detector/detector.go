@@ -21,33 +21,112 @@ type AgentInfo struct {
 	Command string
 	Version string
 	Found   bool
+
+	// Args are passed to Command when the agent runs interactively.
+	Args []string
+	// Env holds extra KEY=VALUE pairs for every agent process.
+	Env []string
+	// VersionFlag is used to query the installed version (default --version).
+	VersionFlag string
+	// NonInteractiveArgs is the argument template for one-shot calls.
+	// "{message}" is replaced with the prompt, which is appended if absent.
+	NonInteractiveArgs []string
+	// SessionStartArgs and SessionResumeArgs are inserted before the message
+	// to create or continue a native CLI session; "{session}" is replaced
+	// with the session ID. Agents without them keep sessions in a
+	// long-lived interactive instance instead.
+	SessionStartArgs  []string
+	SessionResumeArgs []string
+	// StreamArgs are inserted before the message to switch the CLI to a
+	// structured output format for streaming calls; OutputFormat names the
+	// format ("claude-stream-json", "codex-json" or "" for plain text).
+	StreamArgs   []string
+	OutputFormat string
+	// ReadyPatterns and BusyPatterns are regular expressions matched
+	// against the rendered screen of an interactive instance to tell when
+	// it has finished a turn: a visible ready pattern means it waits for
+	// input, a busy pattern (e.g. a spinner hint) means it is still working.
+	ReadyPatterns []string
+	BusyPatterns  []string
+	// Restart is the restart policy of interactive instances ("never",
+	// "on-failure" or "always"; empty means never). RestartMax restarts
+	// are allowed within RestartWindow; zero values use the pool defaults.
+	Restart       string
+	RestartMax    int
+	RestartWindow time.Duration
 }
 
+// Restart policies understood by AgentInfo.Restart.
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// Output formats understood by streaming calls.
+const (
+	OutputText             = ""
+	OutputClaudeStreamJSON = "claude-stream-json"
+	OutputCodexJSON        = "codex-json"
+)
+
 var knownAgents = []AgentInfo{
-	{Type: AgentClaude, Name: "Claude Code", Command: "claude"},
-	{Type: AgentCodex, Name: "Codex", Command: "codex"},
-	{Type: AgentGemini, Name: "Gemini CLI", Command: "gemini"},
+	{
+		Type:               AgentClaude,
+		Name:               "Claude Code",
+		Command:            "claude",
+		NonInteractiveArgs: []string{"-p", "{message}"},
+		SessionStartArgs:   []string{"--session-id", "{session}"},
+		SessionResumeArgs:  []string{"--resume", "{session}"},
+		StreamArgs:         []string{"--output-format", "stream-json", "--verbose"},
+		OutputFormat:       OutputClaudeStreamJSON,
+		ReadyPatterns:      []string{`(?m)^[│ ]*> `},
+		BusyPatterns:       []string{`(?i)esc to interrupt`},
+	},
+	{
+		Type:    AgentCodex,
+		Name:    "Codex",
+		Command: "codex",
+		// Codex uses 'exec' subcommand for non-interactive execution
+		NonInteractiveArgs: []string{"exec", "--sandbox", "danger-full-access", "{message}"},
+		StreamArgs:         []string{"--json"},
+		OutputFormat:       OutputCodexJSON,
+		ReadyPatterns:      []string{`(?m)^\s*[›▌] `},
+		BusyPatterns:       []string{`(?i)esc to interrupt`},
+	},
+	{
+		Type:               AgentGemini,
+		Name:               "Gemini CLI",
+		Command:            "gemini",
+		NonInteractiveArgs: []string{"-p", "{message}"},
+		ReadyPatterns:      []string{`(?i)type your message`},
+		BusyPatterns:       []string{`(?i)esc to cancel`},
+	},
 }
 
 type Detector struct {
 	agents []AgentInfo
 }
 
-func New() *Detector {
-	// Create a copy of knownAgents
-	agents := make([]AgentInfo, len(knownAgents))
-	copy(agents, knownAgents)
+// New returns a detector for the built-in agents merged with the
+// user-defined agents from ConfigPath(). A config that cannot be read or
+// is invalid is an error rather than dropping the custom agents.
+func New() (*Detector, error) {
+	custom, err := LoadConfig(ConfigPath())
+	if err != nil {
+		return nil, err
+	}
 
 	return &Detector{
-		agents: agents,
-	}
+		agents: mergeAgents(knownAgents, custom),
+	}, nil
 }
 
 func (d *Detector) Scan() []AgentInfo {
 	var wg sync.WaitGroup
-	results := make([]AgentInfo, len(knownAgents))
+	results := make([]AgentInfo, len(d.agents))
 
-	for i, agent := range knownAgents {
+	for i, agent := range d.agents {
 		wg.Add(1)
 		go func(idx int, a AgentInfo) {
 			defer wg.Done()
@@ -69,15 +148,18 @@ func (d *Detector) checkAgent(agent AgentInfo) AgentInfo {
 	}
 
 	result.Found = true
-	result.Version = d.getVersion(agent.Command, path)
+	result.Version = d.getVersion(agent.VersionFlag, path)
 	return result
 }
 
-func (d *Detector) getVersion(command, path string) string {
+func (d *Detector) getVersion(flag, path string) string {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, path, "--version")
+	if flag == "" {
+		flag = "--version"
+	}
+	cmd := exec.CommandContext(ctx, path, flag)
 	out, err := cmd.Output()
 	if ctx.Err() == context.DeadlineExceeded {
 		return "unknown (timeout)"
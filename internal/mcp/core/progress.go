@@ -1,29 +1,58 @@
 package core
 
-import "github.com/biliqiqi/ac2/internal/logger"
+import (
+	"context"
+	"sync"
+
+	"github.com/biliqiqi/ac2/internal/logger"
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
 
 // progressReporter implements ProgressReporter interface
 type progressReporter struct {
-	token string
+	ctx     context.Context
+	session *sdkmcp.ServerSession
+	token   any
+
+	mu   sync.Mutex
+	last float64
 }
 
-// NewProgressReporter creates a new progress reporter
-func NewProgressReporter(token string) ProgressReporter {
+// NewProgressReporter creates a progress reporter that sends
+// notifications/progress for token over session.
+func NewProgressReporter(ctx context.Context, session *sdkmcp.ServerSession, token any) ProgressReporter {
 	return &progressReporter{
-		token: token,
+		ctx:     ctx,
+		session: session,
+		token:   token,
+		last:    -1,
 	}
 }
 
-// Report sends a progress notification
+// Report sends a progress notification. progress is a fraction in [0, 1];
+// values that do not increase are nudged forward because the protocol
+// requires progress to grow with every notification.
 func (p *progressReporter) Report(progress float64, message string) error {
-	if p.token == "" {
+	if p.token == nil || p.session == nil {
 		// No progress token, skip reporting
 		return nil
 	}
 
-	// For now, just log the progress
-	// TODO: Send actual MCP progress notification when integrated with SDK
-	logger.Printf("Progress [token=%s]: %.1f%% - %s", p.token, progress*100, message)
+	p.mu.Lock()
+	if progress <= p.last {
+		progress = p.last + 1e-6
+	}
+	p.last = progress
+	p.mu.Unlock()
 
-	return nil
+	err := p.session.NotifyProgress(p.ctx, &sdkmcp.ProgressNotificationParams{
+		ProgressToken: p.token,
+		Progress:      progress,
+		Total:         1,
+		Message:       message,
+	})
+	if err != nil {
+		logger.Printf("Progress [token=%v]: failed to notify: %v", p.token, err)
+	}
+	return err
 }
@@ -36,7 +36,7 @@ type ExecutionContext struct {
 	Context       context.Context
 	AgentPool     *pool.AgentPool
 	Progress      ProgressReporter
-	ProgressToken string // Progress token from request
+	ProgressToken any // Progress token from request, nil when not requested
 }
 
 // ProgressReporter for long-running operations
@@ -10,7 +10,7 @@ import (
 // LogRequest logs the tool call for auditing
 func LogRequest(ctx *core.ExecutionContext, params map[string]any) error {
 	logger.Printf("MCP tool called: has_progress=%v",
-		ctx.ProgressToken != "",
+		ctx.ProgressToken != nil,
 	)
 	return nil
 }
@@ -30,6 +30,9 @@ func registerAgentPrompts(server *sdkmcp.Server, agents []detector.AgentInfo) {
 			Arguments: []*sdkmcp.PromptArgument{
 				{Name: "message", Description: "Message to send to the agent.", Required: true},
 				{Name: "timeout", Description: "Optional timeout in seconds."},
+				{Name: "agent_id", Description: "Optional running instance ID to target."},
+				{Name: "cwd", Description: "Optional working directory for the agent."},
+				{Name: "session_id", Description: "Optional session to continue, or \"new\" to start one."},
 			},
 		}, toolPromptHandler(fmt.Sprintf("ask-%s", agentName), func(args map[string]string) (map[string]any, error) {
 			payload := map[string]any{
@@ -38,6 +41,15 @@ func registerAgentPrompts(server *sdkmcp.Server, agents []detector.AgentInfo) {
 			if timeout, ok := parseOptionalInt(args["timeout"]); ok {
 				payload["timeout"] = timeout
 			}
+			if agentID := args["agent_id"]; agentID != "" {
+				payload["agent_id"] = agentID
+			}
+			if cwd := args["cwd"]; cwd != "" {
+				payload["cwd"] = cwd
+			}
+			if sessionID := args["session_id"]; sessionID != "" {
+				payload["session_id"] = sessionID
+			}
 			return payload, nil
 		}))
 	}
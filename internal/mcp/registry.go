@@ -3,6 +3,7 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -39,19 +40,14 @@ func RegisterTool[In, Out any](
 		req *sdkmcp.CallToolRequest,
 		input In,
 	) (*sdkmcp.CallToolResult, Out, error) {
-		// Extract progress token if available
-		var progressToken string
-		if req.Params.Meta != nil {
-			if token, ok := req.Params.Meta["progressToken"].(string); ok {
-				progressToken = token
-			}
-		}
+		// Extract progress token (string or number) if available
+		progressToken := req.Params.GetProgressToken()
 
 		// Create execution context
 		execCtx := &core.ExecutionContext{
 			Context:       ctx,
 			AgentPool:     r.agentPool,
-			Progress:      core.NewProgressReporter(progressToken),
+			Progress:      core.NewProgressReporter(ctx, req.Session, progressToken),
 			ProgressToken: progressToken,
 		}
 
@@ -77,15 +73,16 @@ func RegisterTool[In, Out any](
 			}
 		}
 
-		// Call the actual handler
+		// Call the actual handler. ctx is cancelled by the SDK when the
+		// client sends notifications/cancelled for this request.
 		output, err := tool.Handler(execCtx, input)
 		if err != nil {
-			// Return error result
+			// Return error result, telling cancellation apart from failure
 			return &sdkmcp.CallToolResult{
 				IsError: true,
 				Content: []sdkmcp.Content{
 					&sdkmcp.TextContent{
-						Text: fmt.Sprintf("Error: %v", err),
+						Text: fmt.Sprintf("%s: %v", errorLabel(err), err),
 					},
 				},
 			}, output, nil
@@ -122,6 +119,20 @@ func RegisterTool[In, Out any](
 	return nil
 }
 
+// errorLabel classifies a tool error for the result text.
+func errorLabel(err error) string {
+	switch {
+	case errors.Is(err, pool.ErrQueueTimeout):
+		return "Rejected"
+	case errors.Is(err, context.Canceled):
+		return "Cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timed out"
+	default:
+		return "Error"
+	}
+}
+
 // List returns all registered tools
 func (r *ToolRegistry) List() []core.RegisteredTool {
 	r.mu.RLock()
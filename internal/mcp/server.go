@@ -2,17 +2,21 @@ package mcp
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/biliqiqi/ac2/internal/detector"
 	"github.com/biliqiqi/ac2/internal/logger"
 	"github.com/biliqiqi/ac2/internal/mcp/prompts"
 	"github.com/biliqiqi/ac2/internal/mcp/tools"
 	"github.com/biliqiqi/ac2/internal/pool"
+	"github.com/modelcontextprotocol/go-sdk/auth"
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -29,6 +33,8 @@ type ServerConfig struct {
 	Name        string
 	Version     string
 	LogRequests bool
+	// AuthToken, when set, is required as a bearer token on HTTP transports
+	AuthToken string
 }
 
 // NewServer creates a new MCP server with the given agent pool
@@ -69,6 +75,12 @@ func (s *Server) EnableRequestLogs(enabled bool) {
 	s.config.LogRequests = enabled
 }
 
+// SetAuthToken requires HTTP clients to send "Authorization: Bearer <token>".
+// An empty token disables authentication.
+func (s *Server) SetAuthToken(token string) {
+	s.config.AuthToken = token
+}
+
 // GetSDKServer returns the underlying SDK server for stdio mode
 func (s *Server) GetSDKServer() *sdkmcp.Server {
 	return s.sdk
@@ -80,14 +92,14 @@ func (s *Server) registerBuiltinTools() {
 
 	// Dynamically register ask-{agent} tools for all known agents
 	logger.Println("Registering dynamic agent tools...")
-	det := detector.New()
-	allAgents := det.GetAll()
+	allAgents := knownAgents()
 
 	for _, agent := range allAgents {
 		toolName := fmt.Sprintf("ask-%s", agent.Type)
 		description := fmt.Sprintf("Directly ask %s (%s) a question or give a task. "+
 			"The agent will be started automatically if not running. "+
-			"Use this for quick, one-off interactions with %s.",
+			"Use this for quick, one-off interactions with %s, or pass session_id "+
+			"(\"new\" to create one) to keep context across calls.",
 			agent.Name, agent.Command, agent.Name)
 
 		tool := tools.NewAskAgentTool(string(agent.Type), description)
@@ -98,33 +110,70 @@ func (s *Server) registerBuiltinTools() {
 		}
 	}
 
+	if err := RegisterTool(s.registry, tools.NewListAgentsTool()); err != nil {
+		logger.Printf("Warning: Failed to register list-agents: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewListSessionsTool()); err != nil {
+		logger.Printf("Warning: Failed to register list-sessions: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewCloseSessionTool()); err != nil {
+		logger.Printf("Warning: Failed to register close-session: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewAgentStartTool()); err != nil {
+		logger.Printf("Warning: Failed to register agent-start: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewAgentSendTool()); err != nil {
+		logger.Printf("Warning: Failed to register agent-send: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewAgentReadScreenTool()); err != nil {
+		logger.Printf("Warning: Failed to register agent-read-screen: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewAgentWaitIdleTool()); err != nil {
+		logger.Printf("Warning: Failed to register agent-wait-idle: %v", err)
+	}
+	if err := RegisterTool(s.registry, tools.NewAgentStopTool()); err != nil {
+		logger.Printf("Warning: Failed to register agent-stop: %v", err)
+	}
+
 	logger.Printf("Successfully registered %d MCP tools", len(s.registry.tools))
 }
 
+// knownAgents returns every agent definition. Startup has already checked
+// the agents config, so an error here means it became invalid since.
+func knownAgents() []detector.AgentInfo {
+	det, err := detector.New()
+	if err != nil {
+		logger.Printf("Warning: %v", err)
+		return nil
+	}
+	return det.GetAll()
+}
+
 // registerBuiltinPrompts registers MCP prompts for custom slash commands
 func (s *Server) registerBuiltinPrompts() {
 	logger.Println("Registering built-in MCP prompts...")
 
-	det := detector.New()
-	allAgents := det.GetAll()
+	allAgents := knownAgents()
 
 	prompts.RegisterBuiltin(s.sdk, allAgents)
 
 	logger.Printf("Registered %d MCP prompts", prompts.CountBuiltin(allAgents))
 }
 
-// ListenHTTP starts HTTP/SSE transports
-func (s *Server) ListenHTTP(addr string) error {
+// Handler returns the HTTP handler serving the streamable HTTP transport on
+// /mcp, the SSE transport on /mcp/sse and a health check on /health.
+func (s *Server) Handler() http.Handler {
 	logger.Println("Setting up MCP HTTP handlers...")
 
 	mux := http.NewServeMux()
+	protect := s.requireToken()
 
 	// SSE endpoint
 	logger.Println("Creating SSE handler...")
 	sseHandler := sdkmcp.NewSSEHandler(func(r *http.Request) *sdkmcp.Server {
 		return s.sdk
 	}, nil)
-	mux.Handle("/mcp/sse", sseHandler)
+	mux.Handle("/mcp/sse", protect(sseHandler))
 	logger.Println("SSE handler registered")
 
 	// Streamable HTTP endpoint
@@ -132,7 +181,7 @@ func (s *Server) ListenHTTP(addr string) error {
 	streamHandler := sdkmcp.NewStreamableHTTPHandler(func(r *http.Request) *sdkmcp.Server {
 		return s.sdk
 	}, nil)
-	mux.Handle("/mcp", streamHandler)
+	mux.Handle("/mcp", protect(streamHandler))
 	logger.Println("Streamable HTTP handler registered")
 
 	// Health check
@@ -145,12 +194,44 @@ func (s *Server) ListenHTTP(addr string) error {
 		})
 	})
 
+	return mux
+}
+
+// requireToken returns middleware enforcing the configured bearer token.
+func (s *Server) requireToken() func(http.Handler) http.Handler {
+	token := s.config.AuthToken
+	if token == "" {
+		return func(h http.Handler) http.Handler { return h }
+	}
+	return auth.RequireBearerToken(func(ctx context.Context, got string, r *http.Request) (*auth.TokenInfo, error) {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return nil, auth.ErrInvalidToken
+		}
+		// The shared token does not expire; the SDK requires a deadline
+		return &auth.TokenInfo{Expiration: time.Now().Add(time.Hour)}, nil
+	}, nil)
+}
+
+// ListenHTTP starts HTTP/SSE transports
+func (s *Server) ListenHTTP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return s.ServeHTTP(listener)
+}
+
+// ServeHTTP serves the HTTP/SSE transports on an existing listener.
+func (s *Server) ServeHTTP(listener net.Listener) error {
+	handler := s.Handler()
+
+	addr := listener.Addr().String()
 	logger.Printf("MCP Server listening on %s", addr)
 	logger.Printf("MCP endpoints:")
 	logger.Printf("  - POST %s/mcp", addr)
 	logger.Printf("  - GET  %s/mcp/sse (SSE)", addr)
 
-	return http.ListenAndServe(addr, mux)
+	return http.Serve(listener, handler)
 }
 
 // ListenUnix starts Unix socket transport
@@ -162,6 +243,11 @@ func (s *Server) ListenUnix(socketPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to listen on unix socket: %w", err)
 	}
+	// Only the owner may connect; the socket has no token check
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to restrict unix socket permissions: %w", err)
+	}
 	defer func() {
 		_ = listener.Close()
 		_ = os.Remove(socketPath)
@@ -171,6 +257,9 @@ func (s *Server) ListenUnix(socketPath string) error {
 
 	for {
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
 			if s.config.LogRequests {
 				logger.Printf("MCP: Accept error: %v", err)
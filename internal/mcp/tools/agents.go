@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/biliqiqi/ac2/internal/mcp/core"
+)
+
+// ListAgentsInput takes no arguments
+type ListAgentsInput struct{}
+
+// AgentSummary describes one pool instance
+type AgentSummary struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Label  string `json:"label,omitempty"`
+	Status string `json:"status"`
+}
+
+// ListAgentsOutput lists the instances in the agent pool
+type ListAgentsOutput struct {
+	Agents []AgentSummary `json:"agents"`
+}
+
+// String formats the output for display
+func (o ListAgentsOutput) String() string {
+	if len(o.Agents) == 0 {
+		return "No agent instances."
+	}
+	var b strings.Builder
+	for _, agent := range o.Agents {
+		fmt.Fprintf(&b, "%s\t%s\t%s", agent.ID, agent.Name, agent.Status)
+		if agent.Label != "" {
+			fmt.Fprintf(&b, "\t%s", agent.Label)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// NewListAgentsTool creates the list-agents tool
+func NewListAgentsTool() *core.UnifiedTool[ListAgentsInput, ListAgentsOutput] {
+	return &core.UnifiedTool[ListAgentsInput, ListAgentsOutput]{
+		Name: "list-agents",
+		Description: "List agent instances managed by ac2 with their IDs, labels and status. " +
+			"Pass an ID as agent_id to an ask tool to talk to that specific instance.",
+		Category: core.CategoryAgent,
+		Handler: func(ctx *core.ExecutionContext, input ListAgentsInput) (ListAgentsOutput, error) {
+			infos := ctx.AgentPool.ListAll()
+			output := ListAgentsOutput{Agents: make([]AgentSummary, 0, len(infos))}
+			for _, info := range infos {
+				output.Agents = append(output.Agents, AgentSummary{
+					ID:     info.ID,
+					Type:   info.Type,
+					Name:   info.Name,
+					Label:  info.Label,
+					Status: string(info.Status),
+				})
+			}
+			return output, nil
+		},
+	}
+}
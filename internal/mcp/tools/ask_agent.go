@@ -2,10 +2,14 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/biliqiqi/ac2/internal/mcp/core"
+	"github.com/biliqiqi/ac2/internal/pool"
 )
 
 // AskAgentInput defines the input for asking a specific agent
@@ -13,17 +17,64 @@ import (
 type AskAgentInput struct {
 	Message string `json:"message"`
 	Timeout int    `json:"timeout,omitempty"`
+	// AgentID targets a running interactive instance (see list-agents)
+	// instead of spawning a one-shot non-interactive process.
+	AgentID string `json:"agent_id,omitempty"`
+	// SessionID keeps context across calls; "new" starts a session with a
+	// generated ID, any other ID must name an open session. Launch options
+	// are fixed when the session is created.
+	SessionID string `json:"session_id,omitempty"`
+	// Cwd, Args and Env customize the spawned process or a new session.
+	// They cannot be combined with AgentID.
+	Cwd  string            `json:"cwd,omitempty"`
+	Args []string          `json:"args,omitempty"`
+	Env  map[string]string `json:"env,omitempty"`
+}
+
+// callOptions converts the launch overrides to pool options.
+func (in AskAgentInput) callOptions() []pool.AgentOption {
+	env := make([]string, 0, len(in.Env))
+	for key, value := range in.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return []pool.AgentOption{
+		pool.WithWorkDir(in.Cwd),
+		pool.WithArgs(in.Args...),
+		pool.WithEnv(env...),
+	}
 }
 
 // CallAgentOutput contains the agent's response
 type CallAgentOutput struct {
-	Response string  `json:"response"`
-	Duration float64 `json:"duration"`
+	Response  string      `json:"response"`
+	Duration  float64     `json:"duration"`
+	SessionID string      `json:"session_id,omitempty"`
+	ExitCode  int         `json:"exit_code"`
+	Stderr    string      `json:"stderr,omitempty"`
+	Usage     *pool.Usage `json:"usage,omitempty"`
+	// Error describes why a call failed; the other fields then hold what
+	// the agent produced before that.
+	Error string `json:"error,omitempty"`
 }
 
 // String formats the output for display
 func (o CallAgentOutput) String() string {
-	return o.Response
+	var notes []string
+	if o.SessionID != "" {
+		notes = append(notes, "session_id: "+o.SessionID)
+	}
+	if o.Usage != nil {
+		usage := fmt.Sprintf("tokens: %d in, %d out", o.Usage.InputTokens, o.Usage.OutputTokens)
+		if o.Usage.CostUSD > 0 {
+			usage += fmt.Sprintf(", cost: $%.4f", o.Usage.CostUSD)
+		}
+		notes = append(notes, usage)
+	}
+	if len(notes) == 0 {
+		return o.Response
+	}
+	return fmt.Sprintf("%s\n\n[%s]", o.Response, strings.Join(notes, "; "))
 }
 
 // NewAskAgentTool creates a UnifiedTool for a specific agent
@@ -47,13 +98,35 @@ func handleAskAgent(
 ) (CallAgentOutput, error) {
 	start := time.Now()
 
+	// Reject invalid calls before reporting any progress
+	if input.AgentID != "" && input.SessionID != "" {
+		return CallAgentOutput{}, fmt.Errorf("agent_id and session_id cannot be used together")
+	}
+	if input.AgentID != "" && (input.Cwd != "" || len(input.Args) > 0 || len(input.Env) > 0) {
+		return CallAgentOutput{}, fmt.Errorf("cwd, args and env cannot be used with agent_id, the instance is already running")
+	}
+	var instance *pool.AgentInstance
+	if input.AgentID != "" {
+		var err error
+		instance, err = ctx.AgentPool.Get(input.AgentID)
+		if err != nil {
+			return CallAgentOutput{}, err
+		}
+		if instance.Type != agentName {
+			return CallAgentOutput{}, fmt.Errorf("agent instance '%s' is a %s agent, not %s", input.AgentID, instance.Type, agentName)
+		}
+		if instance.Status() != pool.StatusRunning {
+			return CallAgentOutput{}, fmt.Errorf("agent instance '%s' is not running", input.AgentID)
+		}
+	}
+
 	// Report progress: starting
-	if ctx.ProgressToken != "" {
+	if ctx.ProgressToken != nil {
 		_ = ctx.Progress.Report(0.1, fmt.Sprintf("Preparing %s in non-interactive mode...", agentName))
 	}
 
 	// Report progress: ready
-	if ctx.ProgressToken != "" {
+	if ctx.ProgressToken != nil {
 		_ = ctx.Progress.Report(0.3, fmt.Sprintf("Running %s command...", agentName))
 	}
 
@@ -67,23 +140,92 @@ func handleAskAgent(
 	defer cancel()
 
 	// Report progress: waiting for response
-	if ctx.ProgressToken != "" {
+	if ctx.ProgressToken != nil {
 		_ = ctx.Progress.Report(0.5, fmt.Sprintf("Waiting for response from %s...", agentName))
 	}
 
-	// Call agent in non-interactive mode
-	response, err := ctx.AgentPool.CallNonInteractive(callCtx, agentName, input.Message)
+	opts := input.callOptions()
+	var onEvent func(pool.StreamEvent)
+	if ctx.ProgressToken != nil {
+		onEvent = outputProgress(ctx)
+		opts = append(opts, pool.WithQueueHandler(func(position int) {
+			_ = ctx.Progress.Report(0.5, fmt.Sprintf("Queued for %s (position %d)...", agentName, position))
+		}))
+	}
+
+	var result *pool.CallResult
+	var err error
+	sessionID := input.SessionID
+	if sessionID == "new" {
+		sessionID, err = ctx.AgentPool.CreateSession(agentName, opts...)
+		if err != nil {
+			return CallAgentOutput{}, err
+		}
+	}
+	if sessionID != "" {
+		result, err = ctx.AgentPool.CallSession(callCtx, agentName, sessionID, input.Message, onEvent, opts...)
+	} else if instance != nil {
+		// Send to a specific running instance
+		var response string
+		response, err = instance.SendAndWait(callCtx, input.Message)
+		result = &pool.CallResult{Text: response}
+	} else {
+		// Call agent in non-interactive mode, streaming its output
+		result, err = ctx.AgentPool.CallStreaming(callCtx, agentName, input.Message, onEvent, opts...)
+	}
+	output := CallAgentOutput{
+		Duration:  time.Since(start).Seconds(),
+		SessionID: sessionID,
+	}
+	if result != nil {
+		output.Response = result.Text
+		output.ExitCode = result.ExitCode
+		output.Stderr = result.Stderr
+		output.Usage = result.Usage
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, pool.ErrQueueTimeout):
+		err = fmt.Errorf("%s is at its concurrency limit and no slot freed up within %s: %w", agentName, timeout, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		err = fmt.Errorf("%s did not answer within %s: %w", agentName, timeout, err)
+	case errors.Is(err, context.Canceled):
+		err = fmt.Errorf("%s call cancelled by the client: %w", agentName, err)
+	default:
+		err = fmt.Errorf("agent call failed: %w", err)
+	}
 	if err != nil {
-		return CallAgentOutput{}, fmt.Errorf("agent call failed: %w", err)
+		// Keep the exit code, stderr and partial output for the caller
+		output.Error = err.Error()
+		return output, err
 	}
 
 	// Report progress: complete
-	if ctx.ProgressToken != "" {
+	if ctx.ProgressToken != nil {
 		_ = ctx.Progress.Report(1.0, "Complete")
 	}
 
-	return CallAgentOutput{
-		Response: response,
-		Duration: time.Since(start).Seconds(),
-	}, nil
+	return output, nil
+}
+
+// progressLineLimit caps the length of output lines forwarded as progress.
+const progressLineLimit = 200
+
+// outputProgress forwards the text of streamed agent output as progress
+// messages. Progress approaches 0.9 asymptotically since the total output
+// size is unknown.
+func outputProgress(ctx *core.ExecutionContext) func(pool.StreamEvent) {
+	lines := 0
+	return func(event pool.StreamEvent) {
+		line := strings.TrimSpace(event.Text)
+		if line == "" {
+			return
+		}
+		lines++
+		if runes := []rune(line); len(runes) > progressLineLimit {
+			line = string(runes[:progressLineLimit]) + "..."
+		}
+		_ = ctx.Progress.Report(0.5+0.4*(1-1/float64(lines+1)), line)
+	}
 }
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/mcp/core"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+type recordingProgress struct {
+	messages []string
+}
+
+func (r *recordingProgress) Report(progress float64, message string) error {
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func TestAskAgentRejectsBeforeProgress(t *testing.T) {
+	agentPool := pool.NewAgentPool([]detector.AgentInfo{{Type: "sh", Name: "Shell", Command: "sh", Found: true}}, "")
+	tests := []struct {
+		name  string
+		input AskAgentInput
+	}{
+		{"agent and session", AskAgentInput{Message: "hi", AgentID: "sh-1", SessionID: "new"}},
+		{"unknown instance", AskAgentInput{Message: "hi", AgentID: "sh-9"}},
+		{"agent and cwd", AskAgentInput{Message: "hi", AgentID: "sh-1", Cwd: "/"}},
+		{"agent and env", AskAgentInput{Message: "hi", AgentID: "sh-1", Env: map[string]string{"A": "1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := &recordingProgress{}
+			ctx := &core.ExecutionContext{
+				Context:       context.Background(),
+				AgentPool:     agentPool,
+				Progress:      progress,
+				ProgressToken: "token",
+			}
+			if _, err := handleAskAgent(ctx, tt.input, "sh"); err == nil {
+				t.Fatal("expected an error")
+			}
+			if len(progress.messages) != 0 {
+				t.Fatalf("progress reported for a rejected call: %q", progress.messages)
+			}
+		})
+	}
+}
+
+func TestAskAgentFailureKeepsOutput(t *testing.T) {
+	agentPool := pool.NewAgentPool([]detector.AgentInfo{{
+		Type:               "sh",
+		Name:               "Shell",
+		Command:            "sh",
+		Found:              true,
+		NonInteractiveArgs: []string{"-c", "{message}"},
+	}}, "")
+	ctx := &core.ExecutionContext{
+		Context:   context.Background(),
+		AgentPool: agentPool,
+		Progress:  &recordingProgress{},
+	}
+
+	output, err := handleAskAgent(ctx, AskAgentInput{Message: "echo partial; echo oops >&2; exit 3"}, "sh")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if output.ExitCode != 3 || output.Stderr != "oops" || output.Response != "partial" || output.Error == "" {
+		t.Fatalf("unexpected output %+v", output)
+	}
+}
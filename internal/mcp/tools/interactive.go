@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/mcp/core"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+const (
+	defaultScrollbackLines = 50
+	defaultWaitSeconds     = 120
+)
+
+// AgentStartInput describes the interactive instance to launch
+type AgentStartInput struct {
+	Agent string            `json:"agent"`
+	Label string            `json:"label,omitempty"`
+	Cwd   string            `json:"cwd,omitempty"`
+	Args  []string          `json:"args,omitempty"`
+	Env   map[string]string `json:"env,omitempty"`
+}
+
+// AgentStartOutput identifies the started instance
+type AgentStartOutput struct {
+	AgentID string `json:"agent_id"`
+	Name    string `json:"name"`
+}
+
+// String formats the output for display
+func (o AgentStartOutput) String() string {
+	return fmt.Sprintf("Started %s as %s. Use agent-wait-idle and agent-read-screen to follow it.", o.Name, o.AgentID)
+}
+
+// NewAgentStartTool creates the agent-start tool
+func NewAgentStartTool() *core.UnifiedTool[AgentStartInput, AgentStartOutput] {
+	return &core.UnifiedTool[AgentStartInput, AgentStartOutput]{
+		Name: "agent-start",
+		Description: "Start a new interactive (TUI) agent instance in the ac2 pool and return its ID. " +
+			"Drive it with agent-send, agent-wait-idle and agent-read-screen, and end it with agent-stop.",
+		Category: core.CategoryAgent,
+		Handler: func(ctx *core.ExecutionContext, input AgentStartInput) (AgentStartOutput, error) {
+			if input.Agent == "" {
+				return AgentStartOutput{}, fmt.Errorf("agent is required")
+			}
+			env := make([]string, 0, len(input.Env))
+			for key, value := range input.Env {
+				env = append(env, key+"="+value)
+			}
+			sort.Strings(env)
+
+			instance, err := ctx.AgentPool.Create(input.Agent,
+				pool.WithQuiet(true),
+				pool.WithAutoRespondDSR(true),
+				pool.WithLabel(input.Label),
+				pool.WithWorkDir(input.Cwd),
+				pool.WithArgs(input.Args...),
+				pool.WithEnv(env...),
+			)
+			if err != nil {
+				return AgentStartOutput{}, err
+			}
+			return AgentStartOutput{AgentID: instance.ID, Name: instance.DisplayName()}, nil
+		},
+	}
+}
+
+// AgentSendInput is typed text and/or key presses for an instance
+type AgentSendInput struct {
+	AgentID string `json:"agent_id"`
+	// Text is typed as-is.
+	Text string `json:"text,omitempty"`
+	// Keys are pressed after Text, e.g. ["enter"] or ["down", "enter"].
+	Keys []string `json:"keys,omitempty"`
+}
+
+// AgentSendOutput confirms the input was delivered
+type AgentSendOutput struct {
+	AgentID string `json:"agent_id"`
+}
+
+// String formats the output for display
+func (o AgentSendOutput) String() string {
+	return fmt.Sprintf("Input sent to %s.", o.AgentID)
+}
+
+// NewAgentSendTool creates the agent-send tool
+func NewAgentSendTool() *core.UnifiedTool[AgentSendInput, AgentSendOutput] {
+	return &core.UnifiedTool[AgentSendInput, AgentSendOutput]{
+		Name: "agent-send",
+		Description: "Type text and/or press keys in an interactive agent instance. Keys are pressed after the text; " +
+			"use [\"enter\"] to submit. Key names: " + strings.Join(pool.KeyNames(), ", ") + ", ctrl-a … ctrl-z. " +
+			"Agents in use in the ac2 terminal cannot be typed into.",
+		Category: core.CategoryComm,
+		Handler: func(ctx *core.ExecutionContext, input AgentSendInput) (AgentSendOutput, error) {
+			if input.Text == "" && len(input.Keys) == 0 {
+				return AgentSendOutput{}, fmt.Errorf("text or keys is required")
+			}
+			instance, err := ctx.AgentPool.Get(input.AgentID)
+			if err != nil {
+				return AgentSendOutput{}, err
+			}
+			if ctx.AgentPool.Foreground(instance) {
+				return AgentSendOutput{}, fmt.Errorf("agent %s is in use in the ac2 terminal and cannot be typed into", instance.ID)
+			}
+			if input.Text != "" {
+				if err := instance.SendText(input.Text); err != nil {
+					return AgentSendOutput{}, err
+				}
+			}
+			if len(input.Keys) > 0 {
+				if input.Text != "" {
+					// Let the TUI process the text before e.g. enter submits it
+					time.Sleep(100 * time.Millisecond)
+				}
+				if err := instance.SendKeys(input.Keys...); err != nil {
+					return AgentSendOutput{}, err
+				}
+			}
+			return AgentSendOutput{AgentID: instance.ID}, nil
+		},
+	}
+}
+
+// AgentReadScreenInput selects the instance and how much history to include
+type AgentReadScreenInput struct {
+	AgentID string `json:"agent_id"`
+	// ScrollbackLines of recent plain-text output to include; 0 uses the
+	// default, -1 leaves it out.
+	ScrollbackLines int `json:"scrollback_lines,omitempty"`
+}
+
+// AgentScreenOutput is the rendered terminal of an instance
+type AgentScreenOutput struct {
+	AgentID    string `json:"agent_id"`
+	Status     string `json:"status"`
+	Screen     string `json:"screen"`
+	CursorX    int    `json:"cursor_x"`
+	CursorY    int    `json:"cursor_y"`
+	Scrollback string `json:"scrollback,omitempty"`
+	// Idle is set by agent-wait-idle.
+	Idle *bool `json:"idle,omitempty"`
+	// Exited is set by agent-wait-idle when the agent exited while it
+	// waited.
+	Exited bool `json:"exited,omitempty"`
+}
+
+// String formats the output for display
+func (o AgentScreenOutput) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s: %s", o.AgentID, o.Status)
+	if o.Exited {
+		b.WriteString(", exited")
+	} else if o.Idle != nil && !*o.Idle {
+		b.WriteString(", still busy")
+	}
+	fmt.Fprintf(&b, "; cursor at row %d, column %d]\n", o.CursorY+1, o.CursorX+1)
+	if o.Scrollback != "" {
+		b.WriteString("--- recent output ---\n")
+		b.WriteString(o.Scrollback)
+		b.WriteString("\n")
+	}
+	b.WriteString("--- screen ---\n")
+	b.WriteString(o.Screen)
+	return b.String()
+}
+
+func readScreen(instance *pool.AgentInstance, scrollbackLines int) AgentScreenOutput {
+	if scrollbackLines == 0 {
+		scrollbackLines = defaultScrollbackLines
+	}
+	x, y, _ := instance.Screen.Cursor()
+	return AgentScreenOutput{
+		AgentID:    instance.ID,
+		Status:     string(instance.Status()),
+		Screen:     instance.Screen.Text(),
+		CursorX:    x,
+		CursorY:    y,
+		Scrollback: instance.Scrollback(scrollbackLines),
+	}
+}
+
+// NewAgentReadScreenTool creates the agent-read-screen tool
+func NewAgentReadScreenTool() *core.UnifiedTool[AgentReadScreenInput, AgentScreenOutput] {
+	return &core.UnifiedTool[AgentReadScreenInput, AgentScreenOutput]{
+		Name: "agent-read-screen",
+		Description: "Read the rendered visible screen of an agent instance, plus recent output as plain text " +
+			"(scrollback_lines, default 50; -1 for none).",
+		Category: core.CategoryComm,
+		Handler: func(ctx *core.ExecutionContext, input AgentReadScreenInput) (AgentScreenOutput, error) {
+			instance, err := ctx.AgentPool.Get(input.AgentID)
+			if err != nil {
+				return AgentScreenOutput{}, err
+			}
+			return readScreen(instance, input.ScrollbackLines), nil
+		},
+	}
+}
+
+// AgentWaitIdleInput configures how long to wait for an instance to settle
+type AgentWaitIdleInput struct {
+	AgentID string `json:"agent_id"`
+	// IdleSeconds of silence that count as idle. When unset the agent's
+	// completion detector decides, using its prompt and busy patterns.
+	IdleSeconds float64 `json:"idle_seconds,omitempty"`
+	// Timeout in seconds (default 120).
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// NewAgentWaitIdleTool creates the agent-wait-idle tool
+func NewAgentWaitIdleTool() *core.UnifiedTool[AgentWaitIdleInput, AgentScreenOutput] {
+	return &core.UnifiedTool[AgentWaitIdleInput, AgentScreenOutput]{
+		Name: "agent-wait-idle",
+		Description: "Wait until an agent instance has finished its turn and waits for input, or the timeout " +
+			"(default 120s) passes, then return its screen like agent-read-screen. exited is set when the agent " +
+			"exited instead. Pass idle_seconds to wait for that much silence instead of using the agent's " +
+			"prompt detection.",
+		Category: core.CategoryComm,
+		Handler: func(ctx *core.ExecutionContext, input AgentWaitIdleInput) (AgentScreenOutput, error) {
+			instance, err := ctx.AgentPool.Get(input.AgentID)
+			if err != nil {
+				return AgentScreenOutput{}, err
+			}
+			timeout := time.Duration(defaultWaitSeconds) * time.Second
+			if input.Timeout > 0 {
+				timeout = time.Duration(input.Timeout) * time.Second
+			}
+
+			waitCtx, cancel := context.WithTimeout(ctx.Context, timeout)
+			defer cancel()
+			if input.IdleSeconds > 0 {
+				err = instance.WaitIdle(waitCtx, time.Duration(input.IdleSeconds*float64(time.Second)))
+			} else {
+				err = instance.WaitReady(waitCtx)
+			}
+			idle, exited := err == nil, false
+			switch {
+			case err == nil:
+			case errors.Is(err, context.DeadlineExceeded) && ctx.Context.Err() == nil:
+				// Still busy; report the screen so the caller can decide
+			case errors.Is(err, context.Canceled):
+				return AgentScreenOutput{}, fmt.Errorf("wait for %s cancelled by the client: %w", instance.ID, err)
+			default:
+				// The agent exited; its final screen is still useful
+				exited = true
+			}
+
+			output := readScreen(instance, -1)
+			output.Idle = &idle
+			output.Exited = exited
+			return output, nil
+		},
+	}
+}
+
+// AgentStopInput identifies the instance to stop
+type AgentStopInput struct {
+	AgentID string `json:"agent_id"`
+}
+
+// AgentStopOutput confirms the instance was stopped
+type AgentStopOutput struct {
+	AgentID string `json:"agent_id"`
+}
+
+// String formats the output for display
+func (o AgentStopOutput) String() string {
+	return fmt.Sprintf("Agent %s stopped.", o.AgentID)
+}
+
+// NewAgentStopTool creates the agent-stop tool
+func NewAgentStopTool() *core.UnifiedTool[AgentStopInput, AgentStopOutput] {
+	return &core.UnifiedTool[AgentStopInput, AgentStopOutput]{
+		Name:        "agent-stop",
+		Description: "Stop an agent instance and every process it started. Agents in use in the ac2 terminal cannot be stopped.",
+		Category:    core.CategoryAgent,
+		Handler: func(ctx *core.ExecutionContext, input AgentStopInput) (AgentStopOutput, error) {
+			instance, err := ctx.AgentPool.Get(input.AgentID)
+			if err != nil {
+				return AgentStopOutput{}, err
+			}
+			// Stopping it would end or disrupt the user's own session
+			if ctx.AgentPool.Foreground(instance) {
+				return AgentStopOutput{}, fmt.Errorf("agent %s is in use in the ac2 terminal and cannot be stopped", instance.ID)
+			}
+			if err := ctx.AgentPool.Stop(input.AgentID); err != nil {
+				return AgentStopOutput{}, err
+			}
+			return AgentStopOutput{AgentID: input.AgentID}, nil
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/mcp/core"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+func newInteractiveTestContext(t *testing.T) *core.ExecutionContext {
+	t.Helper()
+	// cat exits on SIGTERM, unlike an interactive shell
+	agentPool := pool.NewAgentPool([]detector.AgentInfo{{Type: "cat", Name: "Cat", Command: "cat", Found: true}}, "")
+	t.Cleanup(func() { _ = agentPool.Shutdown() })
+	return &core.ExecutionContext{
+		Context:   context.Background(),
+		AgentPool: agentPool,
+		Progress:  &recordingProgress{},
+	}
+}
+
+func TestForegroundAgentIsLeftAlone(t *testing.T) {
+	ctx := newInteractiveTestContext(t)
+	foreground, err := ctx.AgentPool.Create("cat", pool.WithQuiet(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.AgentPool.SetForeground(func(agent *pool.AgentInstance) bool { return agent == foreground })
+
+	if _, err := NewAgentSendTool().Handler(ctx, AgentSendInput{AgentID: foreground.ID, Text: "hi"}); err == nil {
+		t.Fatal("agent-send typed into the foreground agent")
+	}
+	if _, err := NewAgentStopTool().Handler(ctx, AgentStopInput{AgentID: foreground.ID}); err == nil {
+		t.Fatal("agent-stop stopped the foreground agent")
+	}
+	if foreground.Status() != pool.StatusRunning {
+		t.Fatalf("foreground agent is %s", foreground.Status())
+	}
+}
+
+func TestWaitIdleReportsExit(t *testing.T) {
+	ctx := newInteractiveTestContext(t)
+	agent, err := ctx.AgentPool.Create("cat", pool.WithQuiet(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAgentStopTool().Handler(ctx, AgentStopInput{AgentID: agent.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := NewAgentWaitIdleTool().Handler(ctx, AgentWaitIdleInput{AgentID: agent.ID, Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !output.Exited || output.Idle == nil || *output.Idle {
+		t.Fatalf("got idle=%v exited=%v, want an exited agent that is not idle", output.Idle, output.Exited)
+	}
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/mcp/core"
+)
+
+// ListSessionsInput takes no arguments
+type ListSessionsInput struct{}
+
+// SessionSummary describes one open session
+type SessionSummary struct {
+	ID         string `json:"id"`
+	Agent      string `json:"agent"`
+	Mode       string `json:"mode"`
+	InstanceID string `json:"instance_id,omitempty"`
+	Turns      int    `json:"turns"`
+	Busy       bool   `json:"busy"`
+	IdleFor    string `json:"idle_for"`
+}
+
+// ListSessionsOutput lists open ask-agent sessions
+type ListSessionsOutput struct {
+	Sessions []SessionSummary `json:"sessions"`
+}
+
+// String formats the output for display
+func (o ListSessionsOutput) String() string {
+	if len(o.Sessions) == 0 {
+		return "No open sessions."
+	}
+	var b strings.Builder
+	for _, session := range o.Sessions {
+		state := "idle " + session.IdleFor
+		if session.Busy {
+			state = "busy"
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%d turn(s)\t%s\n", session.ID, session.Agent, session.Mode, session.Turns, state)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// NewListSessionsTool creates the list-sessions tool
+func NewListSessionsTool() *core.UnifiedTool[ListSessionsInput, ListSessionsOutput] {
+	return &core.UnifiedTool[ListSessionsInput, ListSessionsOutput]{
+		Name:        "list-sessions",
+		Description: "List open ask-agent sessions created with session_id.",
+		Category:    core.CategoryContext,
+		Handler: func(ctx *core.ExecutionContext, input ListSessionsInput) (ListSessionsOutput, error) {
+			infos := ctx.AgentPool.ListSessions()
+			output := ListSessionsOutput{Sessions: make([]SessionSummary, 0, len(infos))}
+			for _, info := range infos {
+				output.Sessions = append(output.Sessions, SessionSummary{
+					ID:         info.ID,
+					Agent:      info.AgentType,
+					Mode:       string(info.Mode),
+					InstanceID: info.InstanceID,
+					Turns:      info.Turns,
+					Busy:       info.Busy,
+					IdleFor:    time.Since(info.LastUsed).Round(time.Second).String(),
+				})
+			}
+			return output, nil
+		},
+	}
+}
+
+// CloseSessionInput identifies the session to close
+type CloseSessionInput struct {
+	SessionID string `json:"session_id"`
+}
+
+// CloseSessionOutput confirms the session was closed
+type CloseSessionOutput struct {
+	SessionID string `json:"session_id"`
+}
+
+// String formats the output for display
+func (o CloseSessionOutput) String() string {
+	return fmt.Sprintf("Session %s closed.", o.SessionID)
+}
+
+// NewCloseSessionTool creates the close-session tool
+func NewCloseSessionTool() *core.UnifiedTool[CloseSessionInput, CloseSessionOutput] {
+	return &core.UnifiedTool[CloseSessionInput, CloseSessionOutput]{
+		Name:        "close-session",
+		Description: "Close an ask-agent session and stop any agent process kept alive for it.",
+		Category:    core.CategoryContext,
+		Handler: func(ctx *core.ExecutionContext, input CloseSessionInput) (CloseSessionOutput, error) {
+			if input.SessionID == "" {
+				return CloseSessionOutput{}, fmt.Errorf("session_id is required")
+			}
+			if err := ctx.AgentPool.CloseSession(input.SessionID); err != nil {
+				return CloseSessionOutput{}, err
+			}
+			return CloseSessionOutput{SessionID: input.SessionID}, nil
+		},
+	}
+}
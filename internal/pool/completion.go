@@ -0,0 +1,156 @@
+package pool
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/logger"
+)
+
+// CompletionDetector decides when an interactive agent has finished its turn
+// and is waiting for input.
+type CompletionDetector interface {
+	// Ready is called repeatedly with the rendered screen and how long the
+	// agent has printed nothing but spinner frames.
+	Ready(screen string, idle time.Duration) bool
+}
+
+// Defaults for PatternDetector.
+const (
+	// defaultSettle is how long a visible prompt must stay quiet.
+	defaultSettle = 500 * time.Millisecond
+	// defaultQuiet is the silence that ends a turn when no prompt pattern
+	// is known or matches.
+	defaultQuiet = 3 * time.Second
+)
+
+// PatternDetector recognizes the end of a turn from the rendered screen: the
+// agent is busy while any busy pattern matches, ready once a ready pattern
+// matches and output has settled, and otherwise ready after Quiet of silence.
+type PatternDetector struct {
+	ReadyPatterns []*regexp.Regexp
+	BusyPatterns  []*regexp.Regexp
+	Settle        time.Duration
+	Quiet         time.Duration
+}
+
+// NewPatternDetector compiles ready and busy patterns with the default
+// timings. Invalid patterns are logged and skipped.
+func NewPatternDetector(ready, busy []string) *PatternDetector {
+	return &PatternDetector{
+		ReadyPatterns: compilePatterns(ready),
+		BusyPatterns:  compilePatterns(busy),
+		Settle:        defaultSettle,
+		Quiet:         defaultQuiet,
+	}
+}
+
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Printf("Warning: ignoring completion pattern %q: %v", pattern, err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// Ready implements CompletionDetector.
+func (d *PatternDetector) Ready(screen string, idle time.Duration) bool {
+	for _, re := range d.BusyPatterns {
+		if re.MatchString(screen) {
+			return false
+		}
+	}
+	for _, re := range d.ReadyPatterns {
+		if re.MatchString(screen) {
+			return idle >= d.Settle
+		}
+	}
+	return idle >= d.Quiet
+}
+
+// SetCompletionDetector overrides how instances of agentType started from
+// now on decide that a turn is complete. A nil detector restores the one
+// built from the agent's ready and busy patterns.
+func (p *AgentPool) SetCompletionDetector(agentType string, d CompletionDetector) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d == nil {
+		delete(p.detectors, agentType)
+		return
+	}
+	p.detectors[agentType] = d
+}
+
+// completionDetector returns the detector for a new instance. Callers must
+// hold p.mu.
+func (p *AgentPool) completionDetector(agentInfo *detector.AgentInfo) CompletionDetector {
+	if d, ok := p.detectors[string(agentInfo.Type)]; ok {
+		return d
+	}
+	return NewPatternDetector(agentInfo.ReadyPatterns, agentInfo.BusyPatterns)
+}
+
+// WaitReady blocks until the instance's completion detector reports that it
+// waits for input, or ctx is done. It returns an error if the agent exits.
+func (ai *AgentInstance) WaitReady(ctx context.Context) error {
+	return ai.waitUntil(ctx, func() bool {
+		return ai.detector.Ready(ai.Screen.Text(), time.Since(ai.LastOutput()))
+	})
+}
+
+// WaitIdle blocks until the agent has printed nothing but spinner frames
+// for quiet, or ctx is done. It returns an error if the agent exits.
+func (ai *AgentInstance) WaitIdle(ctx context.Context, quiet time.Duration) error {
+	return ai.waitUntil(ctx, func() bool {
+		return time.Since(ai.LastOutput()) >= quiet
+	})
+}
+
+func (ai *AgentInstance) waitUntil(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if err := ai.running(); err != nil {
+			return err
+		}
+		if done() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// spinnerRunes are glyphs agents animate while working.
+const spinnerRunes = "⠁⠂⠄⡀⢀⠠⠐⠈⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏✻✽✶✳✢·*◐◓◑◒◴◷◶◵|/-\\●○◉◎"
+
+// isSpinnerFrame reports whether a chunk of output only redraws a spinner
+// or moves the cursor, so it should not count as the agent making progress.
+func isSpinnerFrame(data []byte) bool {
+	text := []rune(string(data))
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		switch {
+		case r == 0x1b:
+			i = skipEscape(text, i)
+		case unicode.IsSpace(r) || r == '\b' || r < 0x20:
+		case strings.ContainsRune(spinnerRunes, r):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hinshun/vt10x"
+)
+
+// namedKeys maps key names accepted by SendKeys to the bytes a terminal
+// sends for them. Arrow keys are adjusted for application cursor mode.
+var namedKeys = map[string]string{
+	"enter":     "\r",
+	"tab":       "\t",
+	"shift-tab": "\x1b[Z",
+	"escape":    "\x1b",
+	"esc":       "\x1b",
+	"backspace": "\x7f",
+	"delete":    "\x1b[3~",
+	"space":     " ",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+	"pageup":    "\x1b[5~",
+	"pagedown":  "\x1b[6~",
+}
+
+// KeyNames lists the names accepted by SendKeys besides ctrl-<letter>.
+func KeyNames() []string {
+	return []string{"enter", "tab", "shift-tab", "escape", "backspace", "delete", "space",
+		"up", "down", "left", "right", "home", "end", "pageup", "pagedown"}
+}
+
+// keySequence returns the bytes for a named key such as "enter", "up" or
+// "ctrl-c".
+func keySequence(name string, appCursor bool) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	key = strings.ReplaceAll(key, "+", "-")
+
+	if letter, ok := strings.CutPrefix(key, "ctrl-"); ok {
+		if len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' {
+			return string(rune(letter[0] - 'a' + 1)), nil
+		}
+		return "", fmt.Errorf("unknown key %q", name)
+	}
+
+	seq, ok := namedKeys[key]
+	if !ok {
+		return "", fmt.Errorf("unknown key %q", name)
+	}
+	if appCursor {
+		switch key {
+		case "up", "down", "right", "left":
+			seq = "\x1bO" + seq[2:]
+		}
+	}
+	return seq, nil
+}
+
+// running returns an error unless the instance can receive input.
+func (ai *AgentInstance) running() error {
+	if ai.Status() != StatusRunning || ai.Proxy() == nil {
+		return fmt.Errorf("agent instance '%s' is not running", ai.ID)
+	}
+	return nil
+}
+
+// SendText types text into the agent's terminal as-is.
+func (ai *AgentInstance) SendText(text string) error {
+	if err := ai.running(); err != nil {
+		return err
+	}
+	_, err := ai.Proxy().Write([]byte(text))
+	return err
+}
+
+// SendKeys presses named keys in order. Unknown names are rejected before
+// anything is sent.
+func (ai *AgentInstance) SendKeys(keys ...string) error {
+	if err := ai.running(); err != nil {
+		return err
+	}
+	appCursor := ai.Screen.Mode()&vt10x.ModeAppCursor != 0
+	var seq strings.Builder
+	for _, key := range keys {
+		s, err := keySequence(key, appCursor)
+		if err != nil {
+			return err
+		}
+		seq.WriteString(s)
+	}
+	_, err := ai.Proxy().Write([]byte(seq.String()))
+	return err
+}
+
+// Scrollback returns up to lines of recent output as plain text, oldest
+// first, with escape sequences removed. It reads the instance's output
+// buffer, which spans restarts and is sized by SetOutputBuffer.
+func (ai *AgentInstance) Scrollback(lines int) string {
+	if ai.OutputBuffer == nil || lines <= 0 {
+		return ""
+	}
+	data := ai.OutputBuffer.Bytes()
+	if ai.OutputBuffer.Dropped() > 0 {
+		// The oldest line was cut when the buffer wrapped
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	text := strings.TrimRight(plainText(data), "\n ")
+	all := strings.Split(text, "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// LastOutput returns when the agent last printed anything other than
+// spinner frames.
+func (ai *AgentInstance) LastOutput() time.Time {
+	return time.Unix(0, ai.lastOutput.Load())
+}
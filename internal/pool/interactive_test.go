@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+)
+
+func TestScrollbackReadsOutputBuffer(t *testing.T) {
+	// No proxy: scrollback must not depend on the current process
+	instance := &AgentInstance{OutputBuffer: newOutputBuffer(20)}
+	_, _ = instance.OutputBuffer.Write([]byte("\x1b[31mone\x1b[0m\r\ntwo\r\n"))
+	_, _ = instance.OutputBuffer.Write([]byte("three\r\nfour\r\n"))
+
+	if got := instance.Scrollback(2); got != "three\nfour" {
+		t.Fatalf("Scrollback(2) = %q", got)
+	}
+	// The buffer limit applies: "one" has been discarded
+	if got := instance.Scrollback(10); got != "two\nthree\nfour" {
+		t.Fatalf("Scrollback(10) = %q", got)
+	}
+}
+
+func TestSendAndWaitTakesTurns(t *testing.T) {
+	p := NewAgentPool([]detector.AgentInfo{{Type: "cat", Name: "Cat", Command: "cat", Found: true}}, "")
+	t.Cleanup(func() { _ = p.Shutdown() })
+	p.SetCompletionDetector("cat", &PatternDetector{Quiet: 100 * time.Millisecond})
+	agent, err := p.Create("cat", WithQuiet(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	messages := []string{"first", "second", "third"}
+	replies := make(chan string, len(messages))
+	errs := make(chan error, len(messages))
+	for _, message := range messages {
+		go func() {
+			reply, err := agent.SendAndWait(ctx, message)
+			errs <- err
+			replies <- reply
+		}()
+	}
+	for range messages {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		reply := <-replies
+		// Each reply is plain text and holds only its own message
+		if strings.ContainsAny(reply, "\r\x1b") {
+			t.Fatalf("reply is not plain text: %q", reply)
+		}
+		var seen []string
+		for _, message := range messages {
+			if strings.Contains(reply, message) {
+				seen = append(seen, message)
+			}
+		}
+		if len(seen) != 1 {
+			t.Fatalf("reply %q mixes messages %q", reply, seen)
+		}
+	}
+}
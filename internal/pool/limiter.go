@@ -0,0 +1,196 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout is returned when a call's deadline passes while it is
+// still waiting for a free slot.
+var ErrQueueTimeout = errors.New("timed out waiting in queue")
+
+// limiter bounds concurrent delegated calls globally and per agent type.
+// Waiting calls are admitted in FIFO order; a call blocked only by its own
+// type's limit does not hold back calls of other types.
+type limiter struct {
+	mu      sync.Mutex
+	global  int            // 0 means unlimited
+	perType map[string]int // missing or 0 means unlimited
+	running int
+	byType  map[string]int
+	queue   []*waiter
+}
+
+type waiter struct {
+	agentType string
+	ready     chan struct{}
+	onQueue   func(position int)
+	position  int // last reported position
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		perType: make(map[string]int),
+		byType:  make(map[string]int),
+	}
+}
+
+// SetConcurrencyLimits caps the number of delegated calls (one-shot and
+// session calls) running at once, overall and per agent type. Zero means
+// unlimited. Calls over the limit wait in a FIFO queue.
+func (p *AgentPool) SetConcurrencyLimits(global int, perType map[string]int) {
+	l := p.limiter
+	l.mu.Lock()
+	l.global = global
+	l.perType = make(map[string]int, len(perType))
+	for agentType, limit := range perType {
+		l.perType[agentType] = limit
+	}
+	l.mu.Unlock()
+	l.admit()
+}
+
+// acquire blocks until a slot for agentType is free and returns a function
+// releasing it. While queued, onQueue receives the call's 1-based position
+// whenever it changes.
+func (l *limiter) acquire(ctx context.Context, agentType string, onQueue func(int)) (func(), error) {
+	l.mu.Lock()
+	// Waiters still queued do not fit now, as admit runs whenever a slot
+	// frees up; only those of the same type go first
+	if !l.queued(agentType) && l.fits(agentType) {
+		l.take(agentType)
+		l.mu.Unlock()
+		return l.releaser(agentType), nil
+	}
+
+	w := &waiter{agentType: agentType, ready: make(chan struct{}), onQueue: onQueue}
+	l.queue = append(l.queue, w)
+	w.position = len(l.queue)
+	position := w.position
+	l.mu.Unlock()
+
+	if onQueue != nil {
+		onQueue(position)
+	}
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		return l.releaser(agentType), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		removed := l.remove(w)
+		l.mu.Unlock()
+		if !removed {
+			// Admitted concurrently with cancellation; give the slot back
+			<-w.ready
+			l.releaser(agentType)()
+		}
+		// Waiters behind this one may move up
+		l.notifyPositions()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w for a %s slot after %s", ErrQueueTimeout, agentType, time.Since(start).Round(time.Millisecond))
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (l *limiter) releaser(agentType string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.running--
+			l.byType[agentType]--
+			l.mu.Unlock()
+			l.admit()
+		})
+	}
+}
+
+// admit wakes every queued waiter that now fits, in FIFO order.
+func (l *limiter) admit() {
+	l.mu.Lock()
+	admitted := false
+	remaining := l.queue[:0]
+	for _, w := range l.queue {
+		if l.fits(w.agentType) {
+			l.take(w.agentType)
+			close(w.ready)
+			admitted = true
+			continue
+		}
+		remaining = append(remaining, w)
+	}
+	l.queue = remaining
+	l.mu.Unlock()
+
+	if admitted {
+		l.notifyPositions()
+	}
+}
+
+// notifyPositions reports new positions to waiters that moved up.
+func (l *limiter) notifyPositions() {
+	type update struct {
+		fn       func(int)
+		position int
+	}
+	var updates []update
+
+	l.mu.Lock()
+	for i, w := range l.queue {
+		if w.onQueue != nil && w.position != i+1 {
+			w.position = i + 1
+			updates = append(updates, update{w.onQueue, i + 1})
+		}
+	}
+	l.mu.Unlock()
+
+	for _, u := range updates {
+		u.fn(u.position)
+	}
+}
+
+// fits reports whether a call of agentType can start now. Callers must hold l.mu.
+func (l *limiter) fits(agentType string) bool {
+	if l.global > 0 && l.running >= l.global {
+		return false
+	}
+	if limit := l.perType[agentType]; limit > 0 && l.byType[agentType] >= limit {
+		return false
+	}
+	return true
+}
+
+// queued reports whether a call of agentType is waiting. Callers must hold
+// l.mu.
+func (l *limiter) queued(agentType string) bool {
+	for _, w := range l.queue {
+		if w.agentType == agentType {
+			return true
+		}
+	}
+	return false
+}
+
+// take records a started call. Callers must hold l.mu.
+func (l *limiter) take(agentType string) {
+	l.running++
+	l.byType[agentType]++
+}
+
+// remove drops w from the queue, reporting whether it was still queued.
+// Callers must hold l.mu.
+func (l *limiter) remove(w *waiter) bool {
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
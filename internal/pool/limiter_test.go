@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterFIFO(t *testing.T) {
+	l := newLimiter()
+	l.global = 1
+
+	release, err := l.acquire(context.Background(), "claude", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan int, 3)
+	positions := make(chan int, 3)
+	for i := 1; i <= 3; i++ {
+		go func() {
+			rel, err := l.acquire(context.Background(), "claude", func(p int) {
+				if p == i {
+					positions <- p
+				}
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			rel()
+		}()
+		// Queue the waiters in a known order
+		if got := <-positions; got != i {
+			t.Fatalf("waiter %d queued at position %d", i, got)
+		}
+	}
+
+	release()
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-order:
+			if got != want {
+				t.Fatalf("admitted waiter %d, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("waiter %d was not admitted", want)
+		}
+	}
+}
+
+func TestLimiterOtherTypeNotBlocked(t *testing.T) {
+	l := newLimiter()
+	l.global = 3
+	l.perType["claude"] = 1
+
+	release, err := l.acquire(context.Background(), "claude", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	queued := make(chan struct{})
+	go func() {
+		rel, err := l.acquire(context.Background(), "claude", func(int) { close(queued) })
+		if err == nil {
+			rel()
+		}
+	}()
+	<-queued
+
+	// claude is saturated with a waiter at the head; codex still fits
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	rel, err := l.acquire(ctx, "codex", func(int) { t.Error("codex call was queued") })
+	if err != nil {
+		t.Fatalf("codex call: %v", err)
+	}
+	rel()
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := newLimiter()
+	l.perType["claude"] = 1
+
+	release, err := l.acquire(context.Background(), "claude", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "claude", nil); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("got %v, want ErrQueueTimeout", err)
+	}
+
+	// The timed out waiter left the queue, so the slot is free once released
+	release()
+	rel, err := l.acquire(context.Background(), "claude", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel()
+}
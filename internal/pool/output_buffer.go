@@ -0,0 +1,69 @@
+package pool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/ringbuf"
+)
+
+// DefaultOutputBufferSize is how much recent output each instance keeps in
+// memory unless changed with SetOutputBuffer.
+const DefaultOutputBufferSize = 1024 * 1024
+
+// OutputBuffer holds an instance's recent output in a fixed-size ring.
+// Older output is discarded, or appended to a log file when spilling is
+// enabled. It is safe for concurrent use.
+type OutputBuffer struct {
+	*ringbuf.Buffer
+	spill     *os.File
+	spillPath string
+}
+
+func newOutputBuffer(size int) *OutputBuffer {
+	return &OutputBuffer{Buffer: ringbuf.New(size)}
+}
+
+// spillTo appends discarded output to a new log file in dir.
+func (b *OutputBuffer) spillTo(dir, instanceID string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create output log directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.log", instanceID, time.Now().Format("20060102-150405"))
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create output log: %w", err)
+	}
+	b.spill = f
+	b.spillPath = path
+	b.SetSpill(f)
+	return nil
+}
+
+// SpillPath returns the log file receiving discarded output, if any.
+func (b *OutputBuffer) SpillPath() string {
+	return b.spillPath
+}
+
+// String returns the buffered output.
+func (b *OutputBuffer) String() string {
+	return string(b.Bytes())
+}
+
+// Close flushes everything still buffered to the log file and closes it.
+// The in-memory output stays readable.
+func (b *OutputBuffer) Close() error {
+	if b.spill == nil {
+		return nil
+	}
+	b.SetSpill(nil)
+	_, err := b.spill.Write(b.Bytes())
+	if closeErr := b.spill.Close(); err == nil {
+		err = closeErr
+	}
+	b.spill = nil
+	return err
+}
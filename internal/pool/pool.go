@@ -1,17 +1,24 @@
 package pool
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/biliqiqi/ac2/internal/asciicast"
+	"github.com/biliqiqi/ac2/internal/config"
 	"github.com/biliqiqi/ac2/internal/detector"
 	"github.com/biliqiqi/ac2/internal/logger"
 	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
@@ -20,41 +27,107 @@ import (
 
 type Status string
 
+// killGracePeriod is how long a cancelled agent gets to exit after SIGTERM
+// before it is killed.
+const killGracePeriod = 3 * time.Second
+
 const (
 	StatusRunning Status = "running"
 	StatusStopped Status = "stopped"
 	StatusError   Status = "error"
+	// StatusRestarting means the process exited and a restart is pending.
+	StatusRestarting Status = "restarting"
 )
 
 type AgentInstance struct {
-	ID   string
-	Type string
-	Name string
-
-	Proxy  *ptyproxy.Proxy
-	Status Status
-
-	OutputBuffer *bytes.Buffer
+	ID    string
+	Type  string
+	Name  string
+	Label string
+
+	// WorkDir, Args and Env are the per-instance launch overrides.
+	WorkDir string
+	Args    []string
+	Env     []string
+
+	StartedAt time.Time
+
+	// RecordingPath is the asciicast file of this instance, if recorded.
+	RecordingPath string
+	recorder      *asciicast.Recorder
+
+	// proxy is the current process, replaced on restart, and status the
+	// lifecycle state. Both are guarded by stateMu, see Proxy and Status.
+	proxy   *ptyproxy.Proxy
+	status  Status
+	stateMu sync.RWMutex
+
+	// Screen tracks what the agent's terminal currently displays.
+	Screen     *Screen
+	lastOutput atomic.Int64 // unix nanoseconds
+	detector   CompletionDetector
+
+	OutputBuffer *OutputBuffer
 	OutputMu     sync.Mutex
 	OutputSink   io.Writer
 	ExitCh       chan error
 	outputFilter *ansiFilter
 	hintSent     bool
 	hintMu       sync.Mutex
+
+	// options are the launch options, reused when the instance restarts.
+	options      *agentOptions
+	restart      RestartConfig
+	restartMu    sync.Mutex
+	restartTimes []time.Time
+	restartTimer *time.Timer
+	restartCount int
+	stopping     atomic.Bool
+
+	// calls counts SendAndWait calls in progress, see Busy.
+	calls atomic.Int32
+	// turn holds a token while a SendAndWait call talks to the agent, so
+	// concurrent calls take turns instead of interleaving their messages.
+	turn chan struct{}
 }
 
 type AgentPool struct {
-	agents    map[string]*AgentInstance
-	mu        sync.RWMutex
-	available map[string]*detector.AgentInfo
-	counter   map[string]int
-	mcpAddr   string
+	agents       map[string]*AgentInstance
+	mu           sync.RWMutex
+	available    map[string]*detector.AgentInfo
+	counter      map[string]int
+	mcpAddr      string
+	mcpToken     string
+	limiter      *limiter
+	recordDir    string
+	outputSize   int
+	outputLogDir string
+	detectors    map[string]CompletionDetector
+
+	restartHandlers []func(RestartEvent)
+	restartMu       sync.Mutex
+
+	sessions   map[string]*Session
+	sessionsMu sync.Mutex
+	reaperOnce sync.Once
+
+	// mcpConfigPath is the private file holding Claude's MCP config while
+	// a token is set, see claudeMCPConfig.
+	mcpConfigPath string
+
+	// foreground tells the agents a user works with directly, see
+	// SetForeground.
+	foreground func(agent *AgentInstance) bool
 }
 
 type AgentInfo struct {
-	ID     string
-	Type   string
-	Status Status
+	ID        string
+	Type      string
+	Name      string
+	Label     string
+	Status    Status
+	StartedAt time.Time
+	Restarts  int
 }
 
 type AgentOption func(*agentOptions)
@@ -63,6 +136,12 @@ type agentOptions struct {
 	outputSink io.Writer
 	quiet      bool
 	autoDSR    bool
+	label      string
+	workDir    string
+	args       []string
+	env        []string
+	onQueue    func(position int)
+	restart    *RestartConfig
 }
 
 func WithOutputSink(sink io.Writer) AgentOption {
@@ -83,6 +162,86 @@ func WithAutoRespondDSR(enable bool) AgentOption {
 	}
 }
 
+// WithLabel attaches a human-readable label (e.g. a task or worktree name)
+// to a new instance.
+func WithLabel(label string) AgentOption {
+	return func(opts *agentOptions) {
+		opts.label = label
+	}
+}
+
+// WithWorkDir runs the agent in dir instead of ac2's working directory.
+func WithWorkDir(dir string) AgentOption {
+	return func(opts *agentOptions) {
+		opts.workDir = dir
+	}
+}
+
+// WithArgs appends extra CLI arguments (e.g. --model, --resume).
+func WithArgs(args ...string) AgentOption {
+	return func(opts *agentOptions) {
+		opts.args = append(opts.args, args...)
+	}
+}
+
+// WithEnv adds KEY=VALUE pairs that override the inherited environment.
+func WithEnv(env ...string) AgentOption {
+	return func(opts *agentOptions) {
+		opts.env = append(opts.env, env...)
+	}
+}
+
+// WithQueueHandler receives the call's queue position while a delegated
+// call waits for a concurrency slot.
+func WithQueueHandler(fn func(position int)) AgentOption {
+	return func(opts *agentOptions) {
+		opts.onQueue = fn
+	}
+}
+
+func newAgentOptions(opts []AgentOption) *agentOptions {
+	options := &agentOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(options)
+		}
+	}
+	return options
+}
+
+// validate checks the launch overrides before a process is spawned.
+func (o *agentOptions) validate() error {
+	if o.workDir != "" {
+		info, err := os.Stat(o.workDir)
+		if err != nil {
+			return fmt.Errorf("invalid working directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid working directory: %s is not a directory", o.workDir)
+		}
+	}
+	for _, kv := range o.env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return fmt.Errorf("invalid environment entry %q, expected KEY=VALUE", kv)
+		}
+	}
+	return nil
+}
+
+// matches returns an error if o sets a launch override that differs from
+// base. Overrides left unset in o are not compared.
+func (o *agentOptions) matches(base *agentOptions) error {
+	switch {
+	case o.workDir != "" && o.workDir != base.workDir:
+		return fmt.Errorf("cwd %q differs from %q", o.workDir, base.workDir)
+	case len(o.args) > 0 && !slices.Equal(o.args, base.args):
+		return fmt.Errorf("args %q differ from %q", o.args, base.args)
+	case len(o.env) > 0 && !slices.Equal(o.env, base.env):
+		return fmt.Errorf("env %q differs from %q", o.env, base.env)
+	}
+	return nil
+}
+
 func NewAgentPool(available []detector.AgentInfo, mcpAddr string) *AgentPool {
 	availableMap := make(map[string]*detector.AgentInfo)
 	for i := range available {
@@ -91,59 +250,181 @@ func NewAgentPool(available []detector.AgentInfo, mcpAddr string) *AgentPool {
 	}
 
 	return &AgentPool{
-		agents:    make(map[string]*AgentInstance),
-		available: availableMap,
-		counter:   make(map[string]int),
-		mcpAddr:   mcpAddr,
+		agents:     make(map[string]*AgentInstance),
+		available:  availableMap,
+		counter:    make(map[string]int),
+		mcpAddr:    mcpAddr,
+		limiter:    newLimiter(),
+		outputSize: DefaultOutputBufferSize,
+		detectors:  make(map[string]CompletionDetector),
+		sessions:   make(map[string]*Session),
 	}
 }
 
-func (p *AgentPool) setupClaudeMCP(quiet bool) error {
-	// Use official `claude mcp add` command
-	// Reference: https://github.com/anthropics/claude-code
+// SetMCPToken sets the bearer token launched agents present to the ac2 MCP
+// server at mcpAddr.
+func (p *AgentPool) SetMCPToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mcpToken = token
+	p.removeMCPConfig()
+	removeStaleMCPConfigs()
+}
 
-	if !quiet {
-		logger.Printf("Configuring Claude Code MCP via CLI...")
-	}
+// SetForeground sets how to tell the agents a user works with directly,
+// such as the TUI's entry and current agent. Delegating tools leave those
+// agents alone.
+func (p *AgentPool) SetForeground(fn func(agent *AgentInstance) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.foreground = fn
+}
 
-	// Remove existing ac2 MCP server if present
-	cmd := exec.Command("claude", "mcp", "remove", "ac2")
-	_ = cmd.Run() // Ignore error if not exists
+// Foreground reports whether a user works with agent directly.
+func (p *AgentPool) Foreground(agent *AgentInstance) bool {
+	p.mu.RLock()
+	fn := p.foreground
+	p.mu.RUnlock()
+	return fn != nil && fn(agent)
+}
 
-	// Add ac2 MCP server with HTTP transport
-	cmd = exec.Command("claude", "mcp", "add",
-		"--transport", "http",
-		"ac2",
-		p.mcpAddr+"/mcp",
-	)
+// SetRecordDir records every instance started from now on to an asciicast
+// v2 file in dir. An empty dir disables recording.
+func (p *AgentPool) SetRecordDir(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordDir = dir
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to add Claude MCP: %w\nOutput: %s", err, output)
+// SetOutputBuffer limits how much recent output instances started from now
+// on keep in memory. With a non-empty logDir, older output is appended to a
+// per-instance log file there instead of being discarded.
+func (p *AgentPool) SetOutputBuffer(size int, logDir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size <= 0 {
+		size = DefaultOutputBufferSize
 	}
+	p.outputSize = size
+	p.outputLogDir = logDir
+}
 
-	if !quiet {
-		logger.Printf("Claude MCP configured: %s/mcp", p.mcpAddr)
+// buildMCPArgs returns the CLI arguments that point an interactive agent at
+// the ac2 MCP server. The configuration is passed per launch so the user's
+// own agent settings are never modified.
+func (p *AgentPool) buildMCPArgs(agentType string, quiet bool) []string {
+	if p.mcpAddr == "" {
+		return nil
 	}
+	url := p.mcpAddr + "/mcp"
+
+	switch agentType {
+	case "claude":
+		server := map[string]any{"type": "http", "url": url}
+		if p.mcpToken != "" {
+			server["headers"] = map[string]string{"Authorization": "Bearer " + p.mcpToken}
+		}
+		config, err := json.Marshal(map[string]any{
+			"mcpServers": map[string]any{"ac2": server},
+		})
+		if err != nil {
+			return nil
+		}
+		arg, err := p.claudeMCPConfig(config)
+		if err != nil {
+			logger.Printf("Warning: not configuring Claude MCP: %v", err)
+			return nil
+		}
+		if !quiet {
+			logger.Printf("Claude MCP configured via --mcp-config: %s", url)
+		}
+		return []string{"--mcp-config", arg}
+
+	case "codex":
+		args := []string{"-c", fmt.Sprintf("mcp_servers.ac2.url=%q", url)}
+		if p.mcpToken != "" {
+			// The token itself stays out of argv; codex reads it from env
+			args = append(args, "-c", `mcp_servers.ac2.bearer_token_env_var="AC2_MCP_TOKEN"`)
+		}
+		if !quiet {
+			logger.Printf("Codex MCP configured via -c: %s", url)
+		}
+		return args
+	}
+
 	return nil
 }
 
-func (p *AgentPool) setupGeminiMCP(quiet bool) error {
-	// TODO: Research official Gemini CLI MCP configuration
-	// For now, use environment variable fallback
-	if !quiet {
-		logger.Printf("Gemini MCP: No official CLI command found, using env vars")
+// mcpConfigDir holds the Claude MCP config files of running ac2 processes,
+// named mcp-<pid>-*.json.
+func mcpConfigDir() string {
+	return config.Path("run")
+}
+
+// claudeMCPConfig returns the --mcp-config value for config. With a token
+// the config goes to a file in a directory only the user can read, as
+// command lines are visible to every local user. Callers must hold p.mu.
+func (p *AgentPool) claudeMCPConfig(config []byte) (string, error) {
+	if p.mcpToken == "" {
+		return string(config), nil
 	}
-	return nil
+	if p.mcpConfigPath != "" {
+		return p.mcpConfigPath, nil
+	}
+
+	dir := mcpConfigDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	// MkdirAll leaves the mode of an existing directory alone
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return "", err
+	}
+	// CreateTemp creates the file with mode 0600
+	f, err := os.CreateTemp(dir, fmt.Sprintf("mcp-%d-*.json", os.Getpid()))
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(config)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	p.mcpConfigPath = f.Name()
+	return p.mcpConfigPath, nil
 }
 
-func (p *AgentPool) setupCodexMCP(quiet bool) error {
-	// TODO: Research official Codex CLI MCP configuration
-	// For now, use environment variable fallback
-	if !quiet {
-		logger.Printf("Codex MCP: No official CLI command found, using env vars")
+// removeMCPConfig deletes the Claude MCP config file. Callers must hold
+// p.mu.
+func (p *AgentPool) removeMCPConfig() {
+	if p.mcpConfigPath != "" {
+		_ = os.Remove(p.mcpConfigPath)
+		p.mcpConfigPath = ""
+	}
+}
+
+// removeStaleMCPConfigs deletes the Claude MCP config files of ac2
+// processes that did not shut down cleanly.
+func removeStaleMCPConfigs() {
+	dir := mcpConfigDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), "mcp-")
+		pidText, _, found := strings.Cut(rest, "-")
+		pid, err := strconv.Atoi(pidText)
+		if !ok || !found || err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err == nil {
+			logger.Printf("AgentPool: removed stale MCP config %s", entry.Name())
+		}
 	}
-	return nil
 }
 
 func (p *AgentPool) buildMCPEnv(agentType string, quiet bool) []string {
@@ -157,10 +438,9 @@ func (p *AgentPool) buildMCPEnv(agentType string, quiet bool) []string {
 
 	switch agentType {
 	case "claude":
-		// Claude Code is configured via `claude mcp add` command
-		// No environment variables needed
+		// Claude Code is configured via --mcp-config, see buildMCPArgs
 		if !quiet {
-			logger.Printf("Claude MCP configured via CLI command")
+			logger.Printf("Claude MCP configured via CLI arguments")
 		}
 
 	case "gemini":
@@ -171,10 +451,9 @@ func (p *AgentPool) buildMCPEnv(agentType string, quiet bool) []string {
 		}
 
 	case "codex":
-		// Codex CLI MCP configuration via environment variables
-		env = append(env, fmt.Sprintf("MCP_SERVER_URL=%s/mcp", p.mcpAddr))
+		// Codex CLI is configured via -c overrides, see buildMCPArgs
 		if !quiet {
-			logger.Printf("Codex env: MCP_SERVER_URL=%s/mcp", p.mcpAddr)
+			logger.Printf("Codex MCP configured via CLI arguments")
 		}
 
 	default:
@@ -185,33 +464,64 @@ func (p *AgentPool) buildMCPEnv(agentType string, quiet bool) []string {
 		}
 	}
 
+	// Generic variables for wrappers and custom agents
+	env = append(env, fmt.Sprintf("AC2_MCP_URL=%s/mcp", p.mcpAddr))
+	if p.mcpToken != "" {
+		env = append(env, "AC2_MCP_TOKEN="+p.mcpToken)
+	}
+
 	return env
 }
 
+// GetOrCreate returns the oldest running instance of agentType, starting a
+// new one when none is running.
 func (p *AgentPool) GetOrCreate(agentType string, opts ...AgentOption) (*AgentInstance, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	options := &agentOptions{}
-	for _, opt := range opts {
-		if opt != nil {
-			opt(options)
-		}
-	}
+	options := newAgentOptions(opts)
 
-	agentInfo, ok := p.available[agentType]
-	if !ok {
+	if _, ok := p.available[agentType]; !ok {
 		return nil, fmt.Errorf("agent type '%s' not available", agentType)
 	}
 
+	var existing *AgentInstance
 	for _, agent := range p.agents {
-		if agent.Type == agentType && agent.Status == StatusRunning {
-			if options.outputSink != nil {
-				agent.SetOutputSink(options.outputSink)
+		if agent.Type == agentType && agent.Status() == StatusRunning {
+			if existing == nil || agent.StartedAt.Before(existing.StartedAt) {
+				existing = agent
 			}
-			return agent, nil
 		}
 	}
+	if existing != nil {
+		if options.outputSink != nil {
+			existing.SetOutputSink(options.outputSink)
+		}
+		return existing, nil
+	}
+
+	return p.startLocked(agentType, options)
+}
+
+// Create always starts a new instance of agentType, even if others of the
+// same type are already running.
+func (p *AgentPool) Create(agentType string, opts ...AgentOption) (*AgentInstance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.available[agentType]; !ok {
+		return nil, fmt.Errorf("agent type '%s' not available", agentType)
+	}
+
+	return p.startLocked(agentType, newAgentOptions(opts))
+}
+
+// startLocked starts a new instance. Callers must hold p.mu.
+func (p *AgentPool) startLocked(agentType string, options *agentOptions) (*AgentInstance, error) {
+	agentInfo := p.available[agentType]
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
 
 	p.counter[agentType]++
 	id := fmt.Sprintf("%s-%d", agentType, p.counter[agentType])
@@ -220,89 +530,108 @@ func (p *AgentPool) GetOrCreate(agentType string, opts ...AgentOption) (*AgentIn
 		logger.Printf("Starting %s...", id)
 	}
 
-	// Setup MCP configuration via CLI (one-time setup for each agent type)
-	if p.counter[agentType] == 1 {
-		switch agentType {
-		case "claude":
-			if err := p.setupClaudeMCP(options.quiet); err != nil && !options.quiet {
-				logger.Printf("Warning: Failed to setup Claude MCP: %v", err)
-			}
-		case "gemini":
-			if err := p.setupGeminiMCP(options.quiet); err != nil && !options.quiet {
-				logger.Printf("Warning: Failed to setup Gemini MCP: %v", err)
-			}
-		case "codex":
-			if err := p.setupCodexMCP(options.quiet); err != nil && !options.quiet {
-				logger.Printf("Warning: Failed to setup Codex MCP: %v", err)
-			}
-		}
-	}
-
 	instance := &AgentInstance{
 		ID:           id,
 		Type:         agentType,
 		Name:         agentInfo.Name,
-		Status:       StatusStopped,
-		OutputBuffer: new(bytes.Buffer),
+		Label:        options.label,
+		WorkDir:      options.workDir,
+		Args:         options.args,
+		Env:          options.env,
+		status:       StatusStopped,
+		OutputBuffer: newOutputBuffer(p.outputSize),
+		Screen:       newScreen(80, 24),
+		detector:     p.completionDetector(agentInfo),
 		OutputSink:   options.outputSink,
 		ExitCh:       make(chan error, 1),
+		turn:         make(chan struct{}, 1),
+		options:      options,
+		restart:      restartConfig(agentInfo, options.restart),
 	}
 	if agentType == "codex" {
 		instance.outputFilter = &ansiFilter{}
 	}
 
-	proxy := ptyproxy.NewProxy(agentInfo.Command)
+	if p.recordDir != "" {
+		p.startRecording(instance, agentInfo.Command)
+	}
+	if p.outputLogDir != "" {
+		if err := instance.OutputBuffer.spillTo(p.outputLogDir, id); err != nil {
+			logger.Printf("Warning: not logging output of %s: %v", id, err)
+		}
+	}
+
+	if err := p.launchLocked(instance, agentInfo, options); err != nil {
+		if instance.recorder != nil {
+			_ = instance.recorder.Close()
+		}
+		_ = instance.OutputBuffer.Close()
+		return nil, err
+	}
+	instance.StartedAt = time.Now()
+
+	p.agents[id] = instance
+
+	return instance, nil
+}
+
+// launchLocked starts a process for instance and makes it the instance's
+// proxy. Callers must hold p.mu.
+func (p *AgentPool) launchLocked(instance *AgentInstance, agentInfo *detector.AgentInfo, options *agentOptions) error {
+	agentType := instance.Type
+	args := append([]string{}, agentInfo.Args...)
+	args = append(args, p.buildMCPArgs(agentType, options.quiet)...)
+	args = append(args, options.args...)
+	proxy := ptyproxy.NewProxy(agentInfo.Command, args...)
 	proxy.SetAutoRespondDSR(options.autoDSR)
+	proxy.SetDir(options.workDir)
+
+	// Inject agent-defined, MCP and per-instance environment variables;
+	// later entries win over earlier ones.
+	env := append([]string{}, agentInfo.Env...)
+	env = append(env, p.buildMCPEnv(agentType, options.quiet)...)
+	env = append(env, options.env...)
+	proxy.SetEnv(env)
 
-	// Inject MCP environment variables (if needed)
-	mcpEnv := p.buildMCPEnv(agentType, options.quiet)
-	proxy.SetEnv(mcpEnv)
+	if instance.recorder != nil {
+		proxy.SetRecorder(instance.recorder)
+	}
 
 	proxy.SetOutputHandler(func(data []byte) {
+		// The screen models the real terminal, so it sees unfiltered output
+		if !isSpinnerFrame(data) {
+			instance.lastOutput.Store(time.Now().UnixNano())
+		}
+		_, _ = instance.Screen.Write(data)
 		if instance.outputFilter != nil {
 			data = instance.outputFilter.Filter(data)
 			if len(data) == 0 {
 				return
 			}
 		}
+		_, _ = instance.OutputBuffer.Write(data)
 		instance.OutputMu.Lock()
-		instance.OutputBuffer.Write(data)
 		if instance.OutputSink != nil {
 			_, _ = instance.OutputSink.Write(data)
 		}
 		instance.OutputMu.Unlock()
 	})
+	proxy.SetResizeHandler(instance.Screen.Resize)
 	proxy.SetExitHandler(func(err error) {
-		if err != nil {
-			instance.Status = StatusError
-			logger.Printf("Agent %s exited: %v", instance.ID, err)
-			instance.OutputMu.Lock()
-			tail := tailOutput(instance.OutputBuffer, 4096)
-			instance.OutputMu.Unlock()
-			if tail != "" {
-				logger.Printf("Agent %s last output (tail):\n%s", instance.ID, tail)
-			} else {
-				logger.Printf("Agent %s last output (tail): <empty>", instance.ID)
-			}
-		} else {
-			instance.Status = StatusStopped
-		}
-		select {
-		case instance.ExitCh <- err:
-		default:
-		}
+		p.handleExit(instance, err)
 	})
 
-	if err := proxy.Start(&pty.Winsize{Rows: 24, Cols: 80}); err != nil {
-		return nil, fmt.Errorf("failed to start agent: %w", err)
+	cols, rows := instance.Screen.Size()
+	instance.lastOutput.Store(time.Now().UnixNano())
+	if err := proxy.Start(&pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}); err != nil {
+		return fmt.Errorf("failed to start agent: %w", err)
 	}
 
-	instance.Proxy = proxy
-	instance.Status = StatusRunning
-
-	p.agents[id] = instance
-
-	return instance, nil
+	instance.stateMu.Lock()
+	instance.proxy = proxy
+	instance.status = StatusRunning
+	instance.stateMu.Unlock()
+	return nil
 }
 
 func (p *AgentPool) Get(id string) (*AgentInstance, error) {
@@ -317,6 +646,57 @@ func (p *AgentPool) Get(id string) (*AgentInstance, error) {
 	return instance, nil
 }
 
+// startRecording attaches an asciicast recorder to instance. Failures are
+// logged and leave the instance unrecorded.
+func (p *AgentPool) startRecording(instance *AgentInstance, command string) {
+	name := fmt.Sprintf("%s-%s.cast", instance.ID, time.Now().Format("20060102-150405"))
+	path := filepath.Join(p.recordDir, name)
+
+	// MCP arguments are left out of the header since they may carry a token
+	commandLine := strings.Join(append([]string{command}, instance.Args...), " ")
+	rec, err := asciicast.Create(path, asciicast.Header{
+		Width:   80,
+		Height:  24,
+		Command: commandLine,
+		Title:   instance.DisplayName(),
+		Env:     map[string]string{"TERM": "xterm-256color"},
+	})
+	if err != nil {
+		logger.Printf("Warning: not recording %s: %v", instance.ID, err)
+		return
+	}
+	instance.recorder = rec
+	instance.RecordingPath = path
+	logger.Printf("Recording %s to %s", instance.ID, path)
+}
+
+// Stop terminates a running instance and cancels a pending restart. The
+// instance stays listed as stopped.
+func (p *AgentPool) Stop(id string) error {
+	instance, err := p.Get(id)
+	if err != nil {
+		return err
+	}
+	instance.stopping.Store(true)
+	if p.cancelRestart(instance) {
+		logger.Printf("AgentPool: cancelled restart of agent %s", id)
+		return nil
+	}
+	instance.stateMu.Lock()
+	proxy := instance.proxy
+	running := instance.status == StatusRunning && proxy != nil
+	if running {
+		instance.status = StatusStopped
+	}
+	instance.stateMu.Unlock()
+	if !running {
+		return nil
+	}
+
+	logger.Printf("AgentPool: stopping agent %s", id)
+	return proxy.Stop()
+}
+
 func (p *AgentPool) ListAll() []AgentInfo {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -324,24 +704,59 @@ func (p *AgentPool) ListAll() []AgentInfo {
 	result := make([]AgentInfo, 0, len(p.agents))
 	for _, agent := range p.agents {
 		result = append(result, AgentInfo{
-			ID:     agent.ID,
-			Type:   agent.Type,
-			Status: agent.Status,
+			ID:        agent.ID,
+			Type:      agent.Type,
+			Name:      agent.Name,
+			Label:     agent.Label,
+			Status:    agent.Status(),
+			StartedAt: agent.StartedAt,
+			Restarts:  agent.Restarts(),
 		})
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
 
 	return result
 }
 
-func tailOutput(buf *bytes.Buffer, limit int) string {
+// DisplayName returns the agent name followed by its instance ID and label.
+// Proxy returns the instance's current process, which a restart replaces.
+func (ai *AgentInstance) Proxy() *ptyproxy.Proxy {
+	ai.stateMu.RLock()
+	defer ai.stateMu.RUnlock()
+	return ai.proxy
+}
+
+// Status returns the instance's lifecycle status.
+func (ai *AgentInstance) Status() Status {
+	ai.stateMu.RLock()
+	defer ai.stateMu.RUnlock()
+	return ai.status
+}
+
+func (ai *AgentInstance) setStatus(status Status) {
+	ai.stateMu.Lock()
+	ai.status = status
+	ai.stateMu.Unlock()
+}
+
+func (ai *AgentInstance) DisplayName() string {
+	name := ai.Name
+	if name == "" {
+		name = ai.Type
+	}
+	if ai.Label != "" {
+		return fmt.Sprintf("%s (%s: %s)", name, ai.ID, ai.Label)
+	}
+	return fmt.Sprintf("%s (%s)", name, ai.ID)
+}
+
+func tailOutput(buf *OutputBuffer, limit int) string {
 	if buf == nil || limit <= 0 {
 		return ""
 	}
-	data := buf.Bytes()
-	if len(data) <= limit {
-		return string(data)
-	}
-	return string(data[len(data)-limit:])
+	return string(buf.Tail(limit))
 }
 
 func (p *AgentPool) GetAvailableAgents() []detector.AgentInfo {
@@ -358,101 +773,153 @@ func (p *AgentPool) GetAvailableAgents() []detector.AgentInfo {
 	return result
 }
 
-func (p *AgentPool) CallNonInteractive(ctx context.Context, agentType string, message string) (string, error) {
+// CallNonInteractive runs a one-shot agent process and returns its output.
+// WithWorkDir, WithArgs and WithEnv apply to the spawned process.
+func (p *AgentPool) CallNonInteractive(ctx context.Context, agentType string, message string, opts ...AgentOption) (string, error) {
+	agentInfo, err := p.agentInfo(agentType)
+	if err != nil {
+		return "", err
+	}
+
+	options := newAgentOptions(opts)
+	if err := options.validate(); err != nil {
+		return "", err
+	}
+
+	release, err := p.limiter.acquire(ctx, agentType, options.onQueue)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	return runNonInteractive(ctx, agentInfo, message, options, options.args)
+}
+
+func (p *AgentPool) agentInfo(agentType string) (*detector.AgentInfo, error) {
 	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	agentInfo, ok := p.available[agentType]
-	p.mu.RUnlock()
 	if !ok {
-		return "", fmt.Errorf("agent type '%s' not available", agentType)
+		return nil, fmt.Errorf("agent type '%s' not available", agentType)
 	}
+	return agentInfo, nil
+}
 
-	args := buildNonInteractiveArgs(agentType, message)
+// runNonInteractive spawns agentInfo.Command with extra inserted before the
+// message argument.
+func runNonInteractive(ctx context.Context, agentInfo *detector.AgentInfo, message string, options *agentOptions, extra []string) (string, error) {
+	args := buildNonInteractiveArgs(agentInfo, message, extra)
 	cmd := exec.CommandContext(ctx, agentInfo.Command, args...)
-	cmd.Env = os.Environ()
+	cmd.Dir = options.workDir
+	cmd.Env = append(os.Environ(), agentInfo.Env...)
+	cmd.Env = append(cmd.Env, options.env...)
+	setProcessGroup(cmd)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
 		return "", fmt.Errorf("agent command failed: %w\nOutput: %s", err, output)
 	}
 
 	return strings.TrimSpace(string(output)), nil
 }
 
-func buildNonInteractiveArgs(agentType string, message string) []string {
+// buildNonInteractiveArgs expands the agent's argument template. Extra
+// arguments are inserted before the message so that subcommand-style
+// templates (e.g. `codex exec ... {message}`) stay valid.
+func buildNonInteractiveArgs(agentInfo *detector.AgentInfo, message string, extra []string) []string {
+	agentType := strings.ReplaceAll(string(agentInfo.Type), "-", "_")
 	envKey := fmt.Sprintf("AC2_AGENT_ARGS_%s", strings.ToUpper(agentType))
-	rawArgs := strings.TrimSpace(os.Getenv(envKey))
-	if rawArgs == "" {
-		// Default arguments for different agent types
-		switch agentType {
-		case "codex":
-			// Codex uses 'exec' subcommand for non-interactive execution
-			return []string{"exec", "--sandbox", "danger-full-access", message}
-		default:
-			// Claude and Gemini use -p flag
-			return []string{"-p", message}
-		}
+
+	var template []string
+	if rawArgs := strings.TrimSpace(os.Getenv(envKey)); rawArgs != "" {
+		template = strings.Fields(rawArgs)
+	} else if len(agentInfo.NonInteractiveArgs) > 0 {
+		template = agentInfo.NonInteractiveArgs
+	} else {
+		// Fall back to the -p convention shared by Claude and Gemini
+		template = []string{"-p", "{message}"}
 	}
 
-	args := strings.Fields(rawArgs)
+	args := make([]string, 0, len(template)+len(extra)+1)
 	hasPlaceholder := false
-	for i, arg := range args {
+	for _, arg := range template {
 		if strings.Contains(arg, "{message}") {
-			args[i] = strings.ReplaceAll(arg, "{message}", message)
+			if !hasPlaceholder {
+				args = append(args, extra...)
+			}
+			arg = strings.ReplaceAll(arg, "{message}", message)
 			hasPlaceholder = true
 		}
+		args = append(args, arg)
 	}
 
 	if !hasPlaceholder {
+		args = append(args, extra...)
 		args = append(args, message)
 	}
 
 	return args
 }
 
+// SendAndWait submits message and returns the output the agent printed
+// until its completion detector reports that the turn is over, as plain
+// text. Concurrent calls wait for each other.
 func (ai *AgentInstance) SendAndWait(ctx context.Context, message string) (string, error) {
-	ai.OutputMu.Lock()
-	ai.OutputBuffer.Reset()
-	ai.OutputMu.Unlock()
+	ai.calls.Add(1)
+	defer ai.calls.Add(-1)
+
+	select {
+	case ai.turn <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-ai.turn }()
 
-	_, err := ai.Proxy.Write([]byte(message + "\n"))
+	offset := ai.OutputBuffer.Written()
+	sent := time.Now()
+	_, err := ai.Proxy().Write([]byte(message + "\n"))
 	if err != nil {
 		return "", err
 	}
 
-	timeout := 3 * time.Second
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	var lastSize int
-	var silenceStart time.Time
+	// The prompt is still on screen until the agent reacts, so wait for
+	// output before asking the detector
+	if err := ai.waitUntil(ctx, func() bool { return ai.LastOutput().After(sent) }); err != nil {
+		return "", err
+	}
+	if err := ai.WaitReady(ctx); err != nil {
+		return "", err
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-ticker.C:
-			ai.OutputMu.Lock()
-			currentSize := ai.OutputBuffer.Len()
-			ai.OutputMu.Unlock()
+	return strings.TrimSpace(plainText(ai.OutputBuffer.Since(offset))), nil
+}
 
-			if currentSize > lastSize {
-				lastSize = currentSize
-				silenceStart = time.Now()
-				continue
-			}
+// Busy reports whether a delegated call is waiting for the agent to answer.
+func (ai *AgentInstance) Busy() bool {
+	return ai.calls.Load() > 0
+}
 
-			if !silenceStart.IsZero() && time.Since(silenceStart) >= timeout {
-				ai.OutputMu.Lock()
-				result := ai.OutputBuffer.String()
-				ai.OutputMu.Unlock()
-				return result, nil
-			}
+// ErrAgentBusy is returned by IfIdle while a delegated call is in progress.
+var ErrAgentBusy = errors.New("agent is answering a delegated call")
 
-			if silenceStart.IsZero() && currentSize > 0 {
-				silenceStart = time.Now()
-			}
-		}
+// IfIdle runs fn unless a SendAndWait call is in progress or waiting, and
+// holds new calls back until fn returns, e.g. so stopping the agent cannot
+// fail a call half way.
+func (ai *AgentInstance) IfIdle(fn func() error) error {
+	select {
+	case ai.turn <- struct{}{}:
+	default:
+		return ErrAgentBusy
+	}
+	defer func() { <-ai.turn }()
+	if ai.Busy() {
+		return ErrAgentBusy
 	}
+	return fn()
 }
 
 func (ai *AgentInstance) SetOutputSink(sink io.Writer) {
@@ -470,20 +937,25 @@ func (ai *AgentInstance) SendHintOnce(message string) error {
 	ai.hintSent = true
 	ai.hintMu.Unlock()
 
-	if ai.Proxy == nil {
+	if ai.Proxy() == nil {
 		return fmt.Errorf("agent proxy not initialized")
 	}
-	_, err := ai.Proxy.Write([]byte(message + "\n"))
+	_, err := ai.Proxy().Write([]byte(message + "\n"))
 	return err
 }
 
 func (p *AgentPool) Shutdown() error {
+	p.closeAllSessions()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	defer p.removeMCPConfig()
 
 	runningAgents := 0
 	for _, agent := range p.agents {
-		if agent.Status == StatusRunning {
+		agent.stopping.Store(true)
+		p.cancelRestart(agent)
+		if agent.Status() == StatusRunning {
 			runningAgents++
 		}
 	}
@@ -498,16 +970,16 @@ func (p *AgentPool) Shutdown() error {
 
 	count := 0
 	for id, agent := range p.agents {
-		if agent.Status == StatusRunning && agent.Proxy != nil {
+		if agent.Status() == StatusRunning && agent.Proxy() != nil {
 			count++
 			logger.Printf("AgentPool: stopping agent %s (%d/%d)", id, count, runningAgents)
 			fmt.Printf("  [%d/%d] Stopping %s... ", count, runningAgents, id)
 
-			_ = agent.Proxy.Stop()
+			_ = agent.Proxy().Stop()
 
 			// Final wait for shutdown status synchronization
 			startWait := time.Now()
-			for agent.Proxy.Status() != ptyproxy.StatusStopped {
+			for agent.Proxy().Status() != ptyproxy.StatusStopped {
 				if time.Since(startWait) > 3*time.Second {
 					logger.Printf("AgentPool: timeout waiting for agent %s to stop", id)
 					fmt.Printf("\033[33mtimeout\033[0m\n")
@@ -516,7 +988,7 @@ func (p *AgentPool) Shutdown() error {
 				time.Sleep(50 * time.Millisecond)
 			}
 
-			if agent.Proxy.Status() == ptyproxy.StatusStopped {
+			if agent.Proxy().Status() == ptyproxy.StatusStopped {
 				fmt.Printf("\033[32mok\033[0m\n")
 			}
 		}
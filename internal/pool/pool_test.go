@@ -0,0 +1,86 @@
+package pool
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClaudeMCPTokenNotInArgs(t *testing.T) {
+	t.Setenv("AC2_CONFIG_DIR", t.TempDir())
+	p := NewAgentPool(nil, "http://127.0.0.1:8765")
+	p.SetMCPToken("secret-token")
+
+	p.mu.Lock()
+	args := p.buildMCPArgs("claude", true)
+	p.mu.Unlock()
+	if len(args) != 2 || args[0] != "--mcp-config" {
+		t.Fatalf("unexpected args %q", args)
+	}
+	if strings.Contains(strings.Join(args, " "), "secret-token") {
+		t.Fatal("token appears in argv")
+	}
+
+	info, err := os.Stat(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("config mode %o, want 600", mode)
+	}
+	if dir := filepath.Dir(args[1]); dir != mcpConfigDir() {
+		t.Fatalf("config written to %s, want %s", dir, mcpConfigDir())
+	}
+	if info, err := os.Stat(mcpConfigDir()); err != nil || info.Mode().Perm() != 0o700 {
+		t.Fatalf("config directory is not private: %v %v", info.Mode(), err)
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Bearer secret-token") {
+		t.Fatalf("config lacks the token: %s", data)
+	}
+
+	_ = p.Shutdown()
+	if _, err := os.Stat(args[1]); !os.IsNotExist(err) {
+		t.Fatal("config file left behind after shutdown")
+	}
+}
+
+func TestClaudeMCPConfigInlineWithoutToken(t *testing.T) {
+	p := NewAgentPool(nil, "http://127.0.0.1:8765")
+	args := p.buildMCPArgs("claude", true)
+	if len(args) != 2 || !strings.HasPrefix(args[1], "{") {
+		t.Fatalf("unexpected args %q", args)
+	}
+}
+
+func TestStaleMCPConfigsRemoved(t *testing.T) {
+	t.Setenv("AC2_CONFIG_DIR", t.TempDir())
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(mcpConfigDir(), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(mcpConfigDir(), fmt.Sprintf("mcp-%d-1.json", cmd.Process.Pid))
+	live := filepath.Join(mcpConfigDir(), fmt.Sprintf("mcp-%d-2.json", os.Getpid()))
+	for _, path := range []string{stale, live} {
+		if err := os.WriteFile(path, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	NewAgentPool(nil, "http://127.0.0.1:8765").SetMCPToken("secret-token")
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("config of an exited process was kept")
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Fatalf("config of a running process was removed: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package pool
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/logger"
+)
+
+// setProcessGroup runs cmd in its own process group so that cancelling the
+// context terminates every process the agent spawned (node workers, shells,
+// tool subprocesses), not only the direct child. The group gets SIGTERM
+// first and SIGKILL after killGracePeriod.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		logger.Printf("AgentPool: cancelling agent process group %d", pgid)
+		err := syscall.Kill(-pgid, syscall.SIGTERM)
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		time.AfterFunc(killGracePeriod, func() {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		})
+		return err
+	}
+	// Orphans that escaped the group may still hold stdout open; stop
+	// waiting for them shortly after the group has been killed.
+	cmd.WaitDelay = killGracePeriod + time.Second
+}
+
+// processAlive reports whether a process with pid exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package pool
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup bounds how long a cancelled call waits for its output
+// pipes. Windows has no process groups that can be signalled as a unit, so
+// cancellation kills the direct child only.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = killGracePeriod
+}
+
+// processAlive reports whether a process with pid exists. FindProcess
+// opens a handle to the process and fails when there is none.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
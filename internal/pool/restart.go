@@ -0,0 +1,311 @@
+package pool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/logger"
+	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
+)
+
+// RestartPolicy decides whether an interactive instance is started again
+// after its process exits.
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = detector.RestartNever
+	RestartOnFailure RestartPolicy = detector.RestartOnFailure
+	RestartAlways    RestartPolicy = detector.RestartAlways
+)
+
+// Defaults for restart limits and backoff.
+const (
+	DefaultMaxRestarts   = 5
+	DefaultRestartWindow = 10 * time.Minute
+
+	// The delay before a restart starts at restartBackoffMin and doubles
+	// with every restart in the window, up to restartBackoffMax.
+	restartBackoffMin = time.Second
+	restartBackoffMax = 30 * time.Second
+)
+
+// ParseRestartPolicy validates a policy name. An empty name means never.
+func ParseRestartPolicy(value string) (RestartPolicy, error) {
+	switch policy := RestartPolicy(value); policy {
+	case "":
+		return RestartNever, nil
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown restart policy %q, expected never, on-failure or always", value)
+}
+
+// RestartConfig is the restart policy of an instance. An instance that
+// would restart more than MaxRestarts times within Window stays stopped.
+type RestartConfig struct {
+	Policy      RestartPolicy
+	MaxRestarts int
+	Window      time.Duration
+}
+
+// WithRestart overrides the restart policy from the agent definition.
+// Zero limits keep the agent's own or the defaults.
+func WithRestart(cfg RestartConfig) AgentOption {
+	return func(opts *agentOptions) {
+		opts.restart = &cfg
+	}
+}
+
+// restartConfig combines the agent definition, an optional override and the
+// defaults.
+func restartConfig(agentInfo *detector.AgentInfo, override *RestartConfig) RestartConfig {
+	cfg := RestartConfig{
+		Policy:      RestartPolicy(agentInfo.Restart),
+		MaxRestarts: agentInfo.RestartMax,
+		Window:      agentInfo.RestartWindow,
+	}
+	if override != nil {
+		if override.Policy != "" {
+			cfg.Policy = override.Policy
+		}
+		if override.MaxRestarts > 0 {
+			cfg.MaxRestarts = override.MaxRestarts
+		}
+		if override.Window > 0 {
+			cfg.Window = override.Window
+		}
+	}
+	if cfg.Policy == "" {
+		cfg.Policy = RestartNever
+	}
+	if cfg.MaxRestarts <= 0 {
+		cfg.MaxRestarts = DefaultMaxRestarts
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultRestartWindow
+	}
+	return cfg
+}
+
+// applies reports whether an exit with err calls for a restart.
+func (c RestartConfig) applies(err error) bool {
+	switch c.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+// RestartEventType tells what happened to a restarting instance.
+type RestartEventType string
+
+const (
+	// RestartScheduled means the process exited and a new one starts after
+	// Delay.
+	RestartScheduled RestartEventType = "scheduled"
+	// RestartDone means a new process replaced the exited one; Previous is
+	// the proxy of the old process.
+	RestartDone RestartEventType = "restarted"
+	// RestartGaveUp means the instance exited too often and stays stopped.
+	RestartGaveUp RestartEventType = "gave-up"
+)
+
+// RestartEvent reports restart activity of an instance.
+type RestartEvent struct {
+	Type     RestartEventType
+	Instance *AgentInstance
+	Previous *ptyproxy.Proxy
+	// Attempt counts restarts within the window, out of Max.
+	Attempt int
+	Max     int
+	Delay   time.Duration
+	// Err is why the process exited or failed to start.
+	Err error
+}
+
+// String formats the event as a one-line notice.
+func (e RestartEvent) String() string {
+	reason := "exited"
+	if e.Err != nil {
+		reason = fmt.Sprintf("exited (%v)", e.Err)
+	}
+	switch e.Type {
+	case RestartScheduled:
+		return fmt.Sprintf("%s %s, restarting in %s (%d/%d)", e.Instance.ID, reason, e.Delay, e.Attempt, e.Max)
+	case RestartDone:
+		return fmt.Sprintf("%s restarted (%d/%d)", e.Instance.ID, e.Attempt, e.Max)
+	case RestartGaveUp:
+		return fmt.Sprintf("%s %s, giving up after %d restarts", e.Instance.ID, reason, e.Attempt)
+	}
+	return fmt.Sprintf("%s %s", e.Instance.ID, e.Type)
+}
+
+// AddRestartHandler registers fn for restart events of every instance. It
+// is called on the goroutine handling the exit and must not block.
+func (p *AgentPool) AddRestartHandler(fn func(RestartEvent)) {
+	p.restartMu.Lock()
+	defer p.restartMu.Unlock()
+	p.restartHandlers = append(p.restartHandlers, fn)
+}
+
+func (p *AgentPool) emitRestart(event RestartEvent) {
+	logger.Printf("AgentPool: %s", event)
+	p.restartMu.Lock()
+	handlers := append([]func(RestartEvent){}, p.restartHandlers...)
+	p.restartMu.Unlock()
+	for _, fn := range handlers {
+		fn(event)
+	}
+}
+
+// Restarts returns how often the instance has been restarted.
+func (ai *AgentInstance) Restarts() int {
+	ai.restartMu.Lock()
+	defer ai.restartMu.Unlock()
+	return ai.restartCount
+}
+
+// nextRestart counts a restart at now and returns its number within the
+// window and the backoff before it, or ok=false once the limit is reached.
+func (ai *AgentInstance) nextRestart(now time.Time) (attempt int, delay time.Duration, ok bool) {
+	ai.restartMu.Lock()
+	defer ai.restartMu.Unlock()
+
+	recent := ai.restartTimes[:0]
+	for _, t := range ai.restartTimes {
+		if now.Sub(t) < ai.restart.Window {
+			recent = append(recent, t)
+		}
+	}
+	ai.restartTimes = recent
+	if len(recent) >= ai.restart.MaxRestarts {
+		return len(recent), 0, false
+	}
+
+	delay = restartBackoffMin
+	for i := 0; i < len(recent) && delay < restartBackoffMax; i++ {
+		delay *= 2
+	}
+	ai.restartTimes = append(ai.restartTimes, now)
+	return len(ai.restartTimes), min(delay, restartBackoffMax), true
+}
+
+// handleExit runs when the instance's process exits with err. It schedules
+// a restart if the policy asks for one, and otherwise finishes the instance.
+func (p *AgentPool) handleExit(instance *AgentInstance, err error) {
+	if err != nil {
+		logger.Printf("Agent %s exited: %v", instance.ID, err)
+		tail := tailOutput(instance.OutputBuffer, 4096)
+		if tail != "" {
+			logger.Printf("Agent %s last output (tail):\n%s", instance.ID, tail)
+		} else {
+			logger.Printf("Agent %s last output (tail): <empty>", instance.ID)
+		}
+	}
+
+	if instance.stopping.Load() || !instance.restart.applies(err) {
+		p.finishExit(instance, err)
+		return
+	}
+
+	attempt, delay, ok := instance.nextRestart(time.Now())
+	if !ok {
+		p.finishExit(instance, err)
+		p.emitRestart(RestartEvent{Type: RestartGaveUp, Instance: instance, Attempt: attempt, Max: instance.restart.MaxRestarts, Err: err})
+		return
+	}
+
+	instance.setStatus(StatusRestarting)
+	instance.restartMu.Lock()
+	instance.restartTimer = time.AfterFunc(delay, func() { p.restartInstance(instance, attempt) })
+	instance.restartMu.Unlock()
+	p.emitRestart(RestartEvent{Type: RestartScheduled, Instance: instance, Attempt: attempt, Max: instance.restart.MaxRestarts, Delay: delay, Err: err})
+}
+
+// finishExit marks the instance as no longer running and releases its
+// recording and output log.
+func (p *AgentPool) finishExit(instance *AgentInstance, err error) {
+	if err != nil && !instance.stopping.Load() {
+		instance.setStatus(StatusError)
+	} else {
+		instance.setStatus(StatusStopped)
+	}
+	if instance.recorder != nil {
+		_ = instance.recorder.Close()
+	}
+	_ = instance.OutputBuffer.Close()
+	select {
+	case instance.ExitCh <- err:
+	default:
+	}
+}
+
+// restartInstance starts a new process for an instance whose previous one
+// exited, keeping its ID, screen, output buffer and recording.
+func (p *AgentPool) restartInstance(instance *AgentInstance, attempt int) {
+	if instance.stopping.Load() {
+		p.finishExit(instance, nil)
+		return
+	}
+
+	previous := instance.Proxy()
+	_, _ = instance.Screen.Write([]byte("\x1bc"))
+	if instance.recorder != nil {
+		instance.recorder.Marker(fmt.Sprintf("restart %d", attempt))
+	}
+
+	p.mu.Lock()
+	err := p.launchLocked(instance, p.available[instance.Type], instance.options)
+	p.mu.Unlock()
+	if err != nil {
+		logger.Printf("Agent %s failed to restart: %v", instance.ID, err)
+		p.handleExit(instance, err)
+		return
+	}
+	if previous != nil {
+		_ = previous.Close()
+	}
+	instance.restartMu.Lock()
+	instance.restartCount++
+	instance.restartMu.Unlock()
+	if instance.stopping.Load() {
+		// Stopped while the new process was starting
+		_ = instance.Proxy().Stop()
+		return
+	}
+	p.emitRestart(RestartEvent{Type: RestartDone, Instance: instance, Previous: previous, Attempt: attempt, Max: instance.restart.MaxRestarts})
+}
+
+// Relaunch starts a new instance with the type and launch options of the
+// instance id, which should already be stopped. Unlike a policy restart
+// the new instance gets its own ID, output buffer and recording; its
+// output reaches no sink until one is set.
+func (p *AgentPool) Relaunch(id string) (*AgentInstance, error) {
+	previous, err := p.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	options := *previous.options
+	options.outputSink = nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.startLocked(previous.Type, &options)
+}
+
+// cancelRestart stops a pending restart. It reports false if none was
+// pending.
+func (p *AgentPool) cancelRestart(instance *AgentInstance) bool {
+	instance.restartMu.Lock()
+	timer := instance.restartTimer
+	instance.restartMu.Unlock()
+	if timer == nil || !timer.Stop() {
+		return false
+	}
+	p.finishExit(instance, nil)
+	return true
+}
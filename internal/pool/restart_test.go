@@ -0,0 +1,62 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RestartPolicy
+		wantErr bool
+	}{
+		{"", RestartNever, false},
+		{"never", RestartNever, false},
+		{"on-failure", RestartOnFailure, false},
+		{"always", RestartAlways, false},
+		{"sometimes", "", true},
+		{"Always", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestartPolicy(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRestartPolicy(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNextRestartBackoff(t *testing.T) {
+	ai := &AgentInstance{restart: RestartConfig{Policy: RestartAlways, MaxRestarts: 7, Window: time.Hour}}
+	now := time.Now()
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, wantDelay := range want {
+		attempt, delay, ok := ai.nextRestart(now.Add(time.Duration(i) * time.Second))
+		if !ok || attempt != i+1 || delay != wantDelay {
+			t.Fatalf("restart %d: got attempt %d, delay %v, ok %v; want %d, %v, true", i+1, attempt, delay, ok, i+1, wantDelay)
+		}
+	}
+	if attempt, _, ok := ai.nextRestart(now.Add(time.Minute)); ok || attempt != len(want) {
+		t.Fatalf("restart past the limit: got attempt %d, ok %v", attempt, ok)
+	}
+}
+
+func TestNextRestartWindow(t *testing.T) {
+	ai := &AgentInstance{restart: RestartConfig{Policy: RestartAlways, MaxRestarts: 2, Window: time.Minute}}
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, _, ok := ai.nextRestart(now); !ok {
+			t.Fatalf("restart %d refused", i+1)
+		}
+	}
+	if _, _, ok := ai.nextRestart(now.Add(30 * time.Second)); ok {
+		t.Fatal("restart within the window allowed past the limit")
+	}
+
+	// Restarts older than the window no longer count, and the backoff
+	// starts over
+	attempt, delay, ok := ai.nextRestart(now.Add(time.Minute))
+	if !ok || attempt != 1 || delay != restartBackoffMin {
+		t.Fatalf("restart after the window: got attempt %d, delay %v, ok %v", attempt, delay, ok)
+	}
+}
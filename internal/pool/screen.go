@@ -0,0 +1,246 @@
+package pool
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hinshun/vt10x"
+)
+
+// Cell attributes, mirroring vt10x's glyph mode bits.
+const (
+	attrReverse = 1 << iota
+	attrUnderline
+	attrBold
+	_ // line drawing set
+	attrItalic
+	attrBlink
+)
+
+// Cell is one character cell of a Screen.
+type Cell struct {
+	Char rune
+	// FG and BG are ANSI/xterm palette indexes, 24-bit RGB values, or one of
+	// vt10x.DefaultFG and vt10x.DefaultBG.
+	FG, BG    vt10x.Color
+	Bold      bool
+	Italic    bool
+	Underline bool
+	Reverse   bool
+	Blink     bool
+}
+
+// Screen is a virtual terminal that tracks what an agent's PTY currently
+// displays. It is safe for concurrent use.
+type Screen struct {
+	mu      sync.Mutex
+	vt      vt10x.Terminal
+	pending []byte // incomplete UTF-8 sequence from the previous write
+}
+
+func newScreen(cols, rows int) *Screen {
+	return &Screen{vt: vt10x.New(vt10x.WithSize(cols, rows))}
+}
+
+// Write feeds PTY output to the screen.
+func (s *Screen) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(data)
+	if len(s.pending) > 0 {
+		data = append(s.pending, data...)
+		s.pending = nil
+	}
+	// vt10x decodes each write on its own, so hold back a rune split
+	// across reads
+	if cut := incompleteSuffix(data); cut > 0 {
+		s.pending = append([]byte(nil), data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+	_, _ = s.vt.Write(data)
+	return n, nil
+}
+
+// Resize changes the screen size to match the PTY.
+func (s *Screen) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	s.vt.Resize(cols, rows)
+}
+
+// Size returns the screen size.
+func (s *Screen) Size() (cols, rows int) {
+	s.vt.Lock()
+	defer s.vt.Unlock()
+	return s.vt.Size()
+}
+
+// Mode returns the terminal modes set by the agent.
+func (s *Screen) Mode() vt10x.ModeFlag {
+	s.vt.Lock()
+	defer s.vt.Unlock()
+	return s.vt.Mode()
+}
+
+// Text returns the visible screen as plain text, one line per row, with
+// trailing spaces and trailing blank rows removed.
+func (s *Screen) Text() string {
+	s.vt.Lock()
+	defer s.vt.Unlock()
+
+	cols, rows := s.vt.Size()
+	lines := make([]string, rows)
+	var line strings.Builder
+	for y := 0; y < rows; y++ {
+		line.Reset()
+		for x := 0; x < cols; x++ {
+			r := s.vt.Cell(x, y).Char
+			if r == 0 {
+				r = ' '
+			}
+			line.WriteRune(r)
+		}
+		lines[y] = strings.TrimRight(line.String(), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Cells returns the visible screen as rows of styled cells.
+func (s *Screen) Cells() [][]Cell {
+	s.vt.Lock()
+	defer s.vt.Unlock()
+
+	cols, rows := s.vt.Size()
+	cells := make([][]Cell, rows)
+	for y := 0; y < rows; y++ {
+		row := make([]Cell, cols)
+		for x := 0; x < cols; x++ {
+			glyph := s.vt.Cell(x, y)
+			char := glyph.Char
+			if char == 0 {
+				char = ' '
+			}
+			row[x] = Cell{
+				Char:      char,
+				FG:        glyph.FG,
+				BG:        glyph.BG,
+				Bold:      glyph.Mode&attrBold != 0,
+				Italic:    glyph.Mode&attrItalic != 0,
+				Underline: glyph.Mode&attrUnderline != 0,
+				Reverse:   glyph.Mode&attrReverse != 0,
+				Blink:     glyph.Mode&attrBlink != 0,
+			}
+		}
+		cells[y] = row
+	}
+	return cells
+}
+
+// Cursor returns the cursor position, 0-based, and whether it is visible.
+func (s *Screen) Cursor() (x, y int, visible bool) {
+	s.vt.Lock()
+	defer s.vt.Unlock()
+	cursor := s.vt.Cursor()
+	return cursor.X, cursor.Y, s.vt.CursorVisible()
+}
+
+// incompleteSuffix returns the length of a truncated UTF-8 sequence at the
+// end of data, or 0.
+func incompleteSuffix(data []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		b := data[len(data)-i]
+		if b < utf8.RuneSelf {
+			return 0
+		}
+		if utf8.RuneStart(b) {
+			if utf8.FullRune(data[len(data)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+// plainText renders raw terminal output as text: escape sequences are
+// dropped, a lone carriage return starts the line over and backspace
+// removes the previous character.
+func plainText(data []byte) string {
+	var out strings.Builder
+	var line []rune
+	flush := func() {
+		out.WriteString(strings.TrimRight(string(line), " "))
+		out.WriteByte('\n')
+		line = line[:0]
+	}
+
+	text := []rune(string(data))
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		switch {
+		case r == 0x1b:
+			i = skipEscape(text, i)
+		case r == '\n':
+			flush()
+		case r == '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+			line = line[:0]
+		case r == '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case r == '\t':
+			line = append(line, r)
+		case r < 0x20 || r == 0x7f:
+			// Other control characters have no visible effect
+		default:
+			line = append(line, r)
+		}
+	}
+	if len(line) > 0 {
+		flush()
+	}
+	return out.String()
+}
+
+// skipEscape returns the index of the last rune of the escape sequence
+// starting at text[i].
+func skipEscape(text []rune, i int) int {
+	if i+1 >= len(text) {
+		return i
+	}
+	switch text[i+1] {
+	case '[':
+		// CSI: parameters, then a final byte in 0x40-0x7e
+		for j := i + 2; j < len(text); j++ {
+			if text[j] >= 0x40 && text[j] <= 0x7e {
+				return j
+			}
+		}
+		return len(text) - 1
+	case ']', 'P', 'X', '^', '_':
+		// OSC and other strings end with BEL or ESC \
+		for j := i + 2; j < len(text); j++ {
+			if text[j] == 0x07 {
+				return j
+			}
+			if text[j] == 0x1b && j+1 < len(text) && text[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(text) - 1
+	case '(', ')', '*', '+', '#', '%':
+		// Character set selection takes one more byte
+		return min(i+2, len(text)-1)
+	default:
+		return i + 1
+	}
+}
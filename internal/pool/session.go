@@ -0,0 +1,379 @@
+package pool
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/logger"
+)
+
+// sessionIdleTimeout closes sessions that have not been used for a while so
+// forgotten sessions do not keep agent processes alive.
+const sessionIdleTimeout = 30 * time.Minute
+
+// SessionMode tells how a session keeps its conversation context.
+type SessionMode string
+
+const (
+	// SessionNative reuses the CLI's own resume flag on every call.
+	SessionNative SessionMode = "native"
+	// SessionInteractive keeps a long-lived interactive instance.
+	SessionInteractive SessionMode = "interactive"
+)
+
+// Session is a conversation with an agent that spans multiple calls.
+// Launch options are fixed when the session is created.
+type Session struct {
+	ID        string
+	AgentType string
+	Mode      SessionMode
+
+	// NativeID is the session ID handed to the CLI in native mode.
+	NativeID string
+	// Instance backs the session in interactive mode.
+	Instance *AgentInstance
+
+	options   *agentOptions
+	createdAt time.Time
+	lastUsed  time.Time
+	turns     int
+	// calls counts calls in progress, including those still waiting for
+	// the session or a slot, so idle reaping leaves the session alone.
+	calls int
+	mu    sync.Mutex // serializes turns
+}
+
+// errSessionClosed is returned to calls whose session was closed while
+// they waited.
+var errSessionClosed = errors.New("session closed")
+
+// SessionInfo is a snapshot of a session for listing.
+type SessionInfo struct {
+	ID         string
+	AgentType  string
+	Mode       SessionMode
+	InstanceID string
+	Turns      int
+	Busy       bool
+	CreatedAt  time.Time
+	LastUsed   time.Time
+}
+
+// NewSessionID returns a random session ID. Session IDs are the only thing
+// that ties a call to a conversation, so they must not be guessable.
+func NewSessionID() string {
+	return "s-" + randomHex(16)
+}
+
+// CreateSession opens a session with a new ID and returns the ID. The
+// launch options apply to every call in the session.
+func (p *AgentPool) CreateSession(agentType string, opts ...AgentOption) (string, error) {
+	agentInfo, err := p.agentInfo(agentType)
+	if err != nil {
+		return "", err
+	}
+	options := newAgentOptions(opts)
+	if err := options.validate(); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:        NewSessionID(),
+		AgentType: agentType,
+		Mode:      SessionInteractive,
+		options:   options,
+		createdAt: now,
+		lastUsed:  now,
+	}
+	if len(agentInfo.SessionStartArgs) > 0 && len(agentInfo.SessionResumeArgs) > 0 {
+		session.Mode = SessionNative
+		session.NativeID = newUUID()
+	}
+
+	p.sessionsMu.Lock()
+	p.sessions[session.ID] = session
+	p.sessionsMu.Unlock()
+	logger.Printf("AgentPool: created %s session %s for %s", session.Mode, session.ID, agentType)
+
+	p.reaperOnce.Do(func() {
+		go p.reapIdleSessions()
+	})
+
+	return session.ID, nil
+}
+
+// CallSession sends message to the session identified by sessionID, which
+// must have been opened with CreateSession. Agents that define SessionStartArgs and
+// SessionResumeArgs use native CLI resume and stream their output to onEvent;
+// others are backed by an interactive pool instance.
+func (p *AgentPool) CallSession(ctx context.Context, agentType, sessionID, message string, onEvent func(StreamEvent), opts ...AgentOption) (*CallResult, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session id is required")
+	}
+
+	// The session counts this call from here on, so it is not reaped
+	// while the call waits
+	session, err := p.useSession(agentType, sessionID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		p.sessionsMu.Lock()
+		session.calls--
+		session.lastUsed = time.Now()
+		p.sessionsMu.Unlock()
+	}()
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	// Launch options belong to the session, the queue handler to this call
+	release, err := p.limiter.acquire(ctx, agentType, newAgentOptions(opts).onQueue)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if !p.sessionOpen(session) {
+		return nil, errSessionClosed
+	}
+
+	var result *CallResult
+	switch session.Mode {
+	case SessionNative:
+		result, err = p.callNativeSession(ctx, session, message, onEvent)
+	default:
+		result, err = p.callInteractiveSession(ctx, session, message)
+	}
+
+	if err == nil {
+		p.sessionsMu.Lock()
+		session.turns++
+		p.sessionsMu.Unlock()
+	}
+
+	return result, err
+}
+
+// sessionOpen reports whether session is still registered.
+func (p *AgentPool) sessionOpen(session *Session) bool {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	return p.sessions[session.ID] == session
+}
+
+// useSession looks up an open session and counts a call on it.
+func (p *AgentPool) useSession(agentType, sessionID string, opts []AgentOption) (*Session, error) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+
+	session, ok := p.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("session '%s' not found", sessionID)
+	}
+	if session.AgentType != agentType {
+		return nil, fmt.Errorf("session '%s' belongs to %s, not %s", sessionID, session.AgentType, agentType)
+	}
+	// Launch options are fixed when the session is created
+	if err := newAgentOptions(opts).matches(session.options); err != nil {
+		return nil, fmt.Errorf("session '%s' was started with other launch options: %w", sessionID, err)
+	}
+	session.calls++
+	return session, nil
+}
+
+func (p *AgentPool) callNativeSession(ctx context.Context, session *Session, message string, onEvent func(StreamEvent)) (*CallResult, error) {
+	agentInfo, err := p.agentInfo(session.AgentType)
+	if err != nil {
+		return nil, err
+	}
+
+	template := agentInfo.SessionResumeArgs
+	if session.turns == 0 {
+		template = agentInfo.SessionStartArgs
+	}
+	extra := append(expandSessionArgs(template, session.NativeID), session.options.args...)
+
+	result, err := runStreaming(ctx, agentInfo, message, session.options, extra, onEvent)
+	if err != nil && session.turns == 0 {
+		// The CLI may have reserved the ID before failing; start over with a
+		// fresh one so the next call does not collide with it.
+		session.NativeID = newUUID()
+	}
+	return result, err
+}
+
+func (p *AgentPool) callInteractiveSession(ctx context.Context, session *Session, message string) (*CallResult, error) {
+	start := time.Now()
+	instance := session.Instance
+	if instance == nil || instance.Status() != StatusRunning {
+		if !p.sessionOpen(session) {
+			return nil, errSessionClosed
+		}
+		opts := session.options
+		var err error
+		instance, err = p.Create(session.AgentType,
+			WithQuiet(true),
+			WithAutoRespondDSR(true),
+			WithLabel("session "+session.ID),
+			WithWorkDir(opts.workDir),
+			WithArgs(opts.args...),
+			WithEnv(opts.env...),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start session agent: %w", err)
+		}
+		// CloseSession may have run while the instance started; it would
+		// not know to stop it
+		p.sessionsMu.Lock()
+		open := p.sessions[session.ID] == session
+		if open {
+			session.Instance = instance
+		}
+		p.sessionsMu.Unlock()
+		if !open {
+			_ = p.Stop(instance.ID)
+			return nil, errSessionClosed
+		}
+	}
+
+	response, err := instance.SendAndWait(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &CallResult{
+		Text:     response,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// ListSessions returns all open sessions, oldest first.
+func (p *AgentPool) ListSessions() []SessionInfo {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+
+	result := make([]SessionInfo, 0, len(p.sessions))
+	for _, session := range p.sessions {
+		info := SessionInfo{
+			ID:        session.ID,
+			AgentType: session.AgentType,
+			Mode:      session.Mode,
+			Turns:     session.turns,
+			Busy:      session.calls > 0,
+			CreatedAt: session.createdAt,
+			LastUsed:  session.lastUsed,
+		}
+		if session.Instance != nil {
+			info.InstanceID = session.Instance.ID
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// SessionOf returns the ID of the interactive session backed by the
+// instance instanceID, if any.
+func (p *AgentPool) SessionOf(instanceID string) (string, bool) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+	for _, session := range p.sessions {
+		if session.Instance != nil && session.Instance.ID == instanceID {
+			return session.ID, true
+		}
+	}
+	return "", false
+}
+
+// CloseSession forgets a session and stops its interactive instance, if any.
+func (p *AgentPool) CloseSession(id string) error {
+	p.sessionsMu.Lock()
+	session, ok := p.sessions[id]
+	var instance *AgentInstance
+	if ok {
+		instance = session.Instance
+		delete(p.sessions, id)
+	}
+	p.sessionsMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("session '%s' not found", id)
+	}
+
+	logger.Printf("AgentPool: closing session %s", id)
+	if instance != nil {
+		return p.Stop(instance.ID)
+	}
+	return nil
+}
+
+func (p *AgentPool) closeAllSessions() {
+	for _, info := range p.ListSessions() {
+		_ = p.CloseSession(info.ID)
+	}
+}
+
+func (p *AgentPool) reapIdleSessions() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, info := range p.ListSessions() {
+			if !info.Busy && time.Since(info.LastUsed) > sessionIdleTimeout {
+				p.closeIdleSession(info.ID)
+			}
+		}
+	}
+}
+
+// closeIdleSession closes a session unless a call started using it since it
+// was found idle.
+func (p *AgentPool) closeIdleSession(id string) {
+	p.sessionsMu.Lock()
+	session, ok := p.sessions[id]
+	if !ok || session.calls > 0 || time.Since(session.lastUsed) <= sessionIdleTimeout {
+		p.sessionsMu.Unlock()
+		return
+	}
+	delete(p.sessions, id)
+	instance := session.Instance
+	p.sessionsMu.Unlock()
+
+	logger.Printf("AgentPool: session %s idle for %s, closing", id, sessionIdleTimeout)
+	if instance != nil {
+		_ = p.Stop(instance.ID)
+	}
+}
+
+func expandSessionArgs(template []string, id string) []string {
+	args := make([]string, 0, len(template))
+	for _, arg := range template {
+		args = append(args, strings.ReplaceAll(arg, "{session}", id))
+	}
+	return args
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID, the format Claude Code
+// expects for --session-id.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
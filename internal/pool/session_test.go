@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+)
+
+func newTestPool() *AgentPool {
+	return NewAgentPool([]detector.AgentInfo{{Type: "sh", Name: "Shell", Command: "sh", Found: true}}, "")
+}
+
+func TestQueuedSessionCallIsNotReaped(t *testing.T) {
+	p := newTestPool()
+	p.SetConcurrencyLimits(0, map[string]int{"sh": 1})
+	id, err := p.CreateSession("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := p.limiter.acquire(context.Background(), "sh", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.CallSession(context.Background(), "sh", id, "echo hi", nil,
+			WithQueueHandler(func(int) { close(queued) }))
+		done <- err
+	}()
+	<-queued
+
+	if info := p.ListSessions(); len(info) != 1 || !info[0].Busy {
+		t.Fatalf("queued session should be busy: %+v", info)
+	}
+	p.sessionsMu.Lock()
+	p.sessions[id].lastUsed = time.Now().Add(-2 * sessionIdleTimeout)
+	p.sessionsMu.Unlock()
+	p.closeIdleSession(id)
+	if len(p.ListSessions()) != 1 {
+		t.Fatal("reaper closed a session with a queued call")
+	}
+
+	// An explicit close while queued fails the call without starting an
+	// instance
+	if err := p.CloseSession(id); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errSessionClosed) {
+			t.Fatalf("got %v, want errSessionClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not return")
+	}
+	if agents := p.ListAll(); len(agents) != 0 {
+		t.Fatalf("closed session started instances: %+v", agents)
+	}
+}
+
+func TestIdleSessionIsReaped(t *testing.T) {
+	p := newTestPool()
+	id, err := p.CreateSession("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.sessionsMu.Lock()
+	session := p.sessions[id]
+	session.lastUsed = time.Now().Add(-2 * sessionIdleTimeout)
+	p.sessionsMu.Unlock()
+
+	p.closeIdleSession(id)
+	if len(p.ListSessions()) != 0 {
+		t.Fatal("idle session was not closed")
+	}
+}
+
+func TestSessionRejectsOtherLaunchOptions(t *testing.T) {
+	p := newTestPool()
+	dir := t.TempDir()
+	id, err := p.CreateSession("sh", WithWorkDir(dir), WithEnv("A=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []AgentOption
+		wantErr bool
+	}{
+		{"unset", nil, false},
+		{"same", []AgentOption{WithWorkDir(dir), WithEnv("A=1")}, false},
+		{"other cwd", []AgentOption{WithWorkDir(t.TempDir())}, true},
+		{"other env", []AgentOption{WithEnv("A=2")}, true},
+		{"new args", []AgentOption{WithArgs("-x")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.useSession("sh", id, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCallSessionRequiresCreatedSession(t *testing.T) {
+	p := newTestPool()
+	_, err := p.CallSession(context.Background(), "sh", "s-guess", "echo hi", nil)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("got %v, want a session not found error", err)
+	}
+	if sessions := p.ListSessions(); len(sessions) != 0 {
+		t.Fatalf("unknown ID created a session: %+v", sessions)
+	}
+}
@@ -0,0 +1,369 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+)
+
+// Stream names used in StreamEvent.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// StreamEvent is one line of output from a streaming call.
+type StreamEvent struct {
+	Stream string
+	// Line is the raw line without its trailing newline.
+	Line string
+	// Text is the human-readable text carried by the line, if any. For JSON
+	// output formats it is the assistant text; empty for bookkeeping events.
+	Text string
+}
+
+// Usage is the token and cost metadata an agent reports for a call.
+type Usage struct {
+	InputTokens     int64   `json:"input_tokens"`
+	OutputTokens    int64   `json:"output_tokens"`
+	CacheReadTokens int64   `json:"cache_read_tokens,omitempty"`
+	CostUSD         float64 `json:"cost_usd,omitempty"`
+}
+
+// CallResult is the structured outcome of a streaming call.
+type CallResult struct {
+	Text     string
+	ExitCode int
+	Stderr   string
+	// Usage is nil when the agent does not report it.
+	Usage *Usage
+	// NativeSessionID is the CLI's own session or thread ID, if reported.
+	NativeSessionID string
+	Duration        time.Duration
+}
+
+// CallStreaming runs a one-shot agent process like CallNonInteractive but
+// reads stdout and stderr separately, passing every line to onEvent as it
+// arrives. Agents with StreamArgs are switched to their structured output
+// format so the final text, session ID and usage can be extracted.
+//
+// On a non-zero exit the partial result is returned together with an error.
+func (p *AgentPool) CallStreaming(ctx context.Context, agentType, message string, onEvent func(StreamEvent), opts ...AgentOption) (*CallResult, error) {
+	agentInfo, err := p.agentInfo(agentType)
+	if err != nil {
+		return nil, err
+	}
+
+	options := newAgentOptions(opts)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	release, err := p.limiter.acquire(ctx, agentType, options.onQueue)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return runStreaming(ctx, agentInfo, message, options, options.args, onEvent)
+}
+
+func runStreaming(ctx context.Context, agentInfo *detector.AgentInfo, message string, options *agentOptions, extra []string, onEvent func(StreamEvent)) (*CallResult, error) {
+	start := time.Now()
+
+	streamExtra := make([]string, 0, len(agentInfo.StreamArgs)+len(extra))
+	streamExtra = append(streamExtra, agentInfo.StreamArgs...)
+	streamExtra = append(streamExtra, extra...)
+	args := buildNonInteractiveArgs(agentInfo, message, streamExtra)
+
+	cmd := exec.CommandContext(ctx, agentInfo.Command, args...)
+	cmd.Dir = options.workDir
+	cmd.Env = append(os.Environ(), agentInfo.Env...)
+	cmd.Env = append(cmd.Env, options.env...)
+	setProcessGroup(cmd)
+
+	parser := newOutputParser(agentInfo.OutputFormat)
+	var stderrBuf strings.Builder
+
+	var eventMu sync.Mutex
+	emit := func(event StreamEvent) {
+		if onEvent == nil {
+			return
+		}
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		onEvent(event)
+	}
+
+	// exec.Cmd copies each stream from its own goroutine, so the parser and
+	// stderrBuf are each only touched by one writer.
+	stdout := &lineWriter{fn: func(line string) {
+		emit(StreamEvent{Stream: StreamStdout, Line: line, Text: parser.parse(line)})
+	}}
+	stderr := &lineWriter{fn: func(line string) {
+		stderrBuf.WriteString(line)
+		stderrBuf.WriteByte('\n')
+		emit(StreamEvent{Stream: StreamStderr, Line: line, Text: line})
+	}}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	result := parser.result()
+	result.Stderr = strings.TrimSpace(stderrBuf.String())
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		if result.Stderr != "" {
+			return result, fmt.Errorf("agent command failed: %w\nStderr: %s", err, result.Stderr)
+		}
+		return result, fmt.Errorf("agent command failed: %w", err)
+	}
+	if parser.failed() != "" {
+		return result, fmt.Errorf("agent reported an error: %s", parser.failed())
+	}
+
+	return result, nil
+}
+
+// lineWriter splits written data into lines and hands each complete line,
+// without its trailing newline, to fn. There is no line length limit since
+// JSON events can carry whole tool outputs.
+type lineWriter struct {
+	fn      func(string)
+	pending []byte
+}
+
+func (w *lineWriter) Write(data []byte) (int, error) {
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimRight(w.pending[:idx], "\r")
+		w.fn(string(line))
+		w.pending = w.pending[idx+1:]
+	}
+	return len(data), nil
+}
+
+// Flush emits a trailing line that was not newline-terminated.
+func (w *lineWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.fn(string(w.pending))
+		w.pending = nil
+	}
+}
+
+// outputParser extracts text and metadata from a stdout stream. parse is
+// called from a single goroutine; result and failed after it is done.
+type outputParser interface {
+	parse(line string) string
+	result() *CallResult
+	failed() string
+}
+
+func newOutputParser(format string) outputParser {
+	switch format {
+	case detector.OutputClaudeStreamJSON:
+		return &claudeStreamParser{}
+	case detector.OutputCodexJSON:
+		return &codexJSONParser{}
+	default:
+		return &textParser{}
+	}
+}
+
+// textParser treats stdout as the answer.
+type textParser struct {
+	buf strings.Builder
+}
+
+func (t *textParser) parse(line string) string {
+	t.buf.WriteString(line)
+	t.buf.WriteByte('\n')
+	return line
+}
+
+func (t *textParser) result() *CallResult {
+	return &CallResult{Text: strings.TrimSpace(t.buf.String())}
+}
+
+func (t *textParser) failed() string { return "" }
+
+// claudeStreamParser understands `claude -p --output-format stream-json`.
+type claudeStreamParser struct {
+	texts     []string
+	final     string
+	hasFinal  bool
+	sessionID string
+	usage     *Usage
+	errorText string
+}
+
+type claudeEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Message   struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"message"`
+	Result       string  `json:"result"`
+	IsError      bool    `json:"is_error"`
+	TotalCostUSD float64 `json:"total_cost_usd"`
+	Usage        *struct {
+		InputTokens          int64 `json:"input_tokens"`
+		OutputTokens         int64 `json:"output_tokens"`
+		CacheReadInputTokens int64 `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+func (c *claudeStreamParser) parse(line string) string {
+	var event claudeEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		// Not an event; keep it so nothing is silently dropped
+		c.texts = append(c.texts, line)
+		return line
+	}
+	if event.SessionID != "" {
+		c.sessionID = event.SessionID
+	}
+
+	switch event.Type {
+	case "assistant":
+		var parts []string
+		for _, block := range event.Message.Content {
+			if block.Type == "text" && block.Text != "" {
+				parts = append(parts, block.Text)
+			}
+		}
+		text := strings.Join(parts, "\n")
+		if text != "" {
+			c.texts = append(c.texts, text)
+		}
+		return text
+	case "result":
+		c.final = event.Result
+		c.hasFinal = true
+		if event.IsError {
+			c.errorText = event.Result
+		}
+		if event.Usage != nil || event.TotalCostUSD > 0 {
+			c.usage = &Usage{CostUSD: event.TotalCostUSD}
+			if event.Usage != nil {
+				c.usage.InputTokens = event.Usage.InputTokens
+				c.usage.OutputTokens = event.Usage.OutputTokens
+				c.usage.CacheReadTokens = event.Usage.CacheReadInputTokens
+			}
+		}
+	}
+	return ""
+}
+
+func (c *claudeStreamParser) result() *CallResult {
+	text := c.final
+	if !c.hasFinal {
+		text = strings.Join(c.texts, "\n")
+	}
+	return &CallResult{
+		Text:            strings.TrimSpace(text),
+		Usage:           c.usage,
+		NativeSessionID: c.sessionID,
+	}
+}
+
+func (c *claudeStreamParser) failed() string { return c.errorText }
+
+// codexJSONParser understands `codex exec --json`.
+type codexJSONParser struct {
+	lastMessage string
+	raw         []string
+	threadID    string
+	usage       *Usage
+	errorText   string
+}
+
+type codexEvent struct {
+	Type     string `json:"type"`
+	ThreadID string `json:"thread_id"`
+	Message  string `json:"message"`
+	Item     struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"item"`
+	Usage *struct {
+		InputTokens       int64 `json:"input_tokens"`
+		CachedInputTokens int64 `json:"cached_input_tokens"`
+		OutputTokens      int64 `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *codexJSONParser) parse(line string) string {
+	var event codexEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		c.raw = append(c.raw, line)
+		return line
+	}
+
+	switch event.Type {
+	case "thread.started":
+		c.threadID = event.ThreadID
+	case "item.completed":
+		if event.Item.Type == "agent_message" {
+			c.lastMessage = event.Item.Text
+			return event.Item.Text
+		}
+	case "turn.completed":
+		if event.Usage != nil {
+			c.usage = &Usage{
+				InputTokens:     event.Usage.InputTokens,
+				OutputTokens:    event.Usage.OutputTokens,
+				CacheReadTokens: event.Usage.CachedInputTokens,
+			}
+		}
+	case "turn.failed":
+		c.errorText = event.Error.Message
+	case "error":
+		c.errorText = event.Message
+	}
+	return ""
+}
+
+func (c *codexJSONParser) result() *CallResult {
+	text := c.lastMessage
+	if text == "" {
+		text = strings.Join(c.raw, "\n")
+	}
+	return &CallResult{
+		Text:            strings.TrimSpace(text),
+		Usage:           c.usage,
+		NativeSessionID: c.threadID,
+	}
+}
+
+func (c *codexJSONParser) failed() string { return c.errorText }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/biliqiqi/ac2/internal/ringbuf"
 	"github.com/creack/pty"
 )
 
@@ -46,6 +47,7 @@ type Proxy struct {
 	command string
 	args    []string
 	env     []string
+	dir     string
 	cmd     *exec.Cmd
 	ptmx    *os.File
 	status  Status
@@ -53,10 +55,35 @@ type Proxy struct {
 
 	onOutput func([]byte)
 	onExit   func(error)
+	onResize func(cols, rows int)
 
 	handlers       map[string]*OutputHandler
 	handlersMu     sync.RWMutex
 	autoRespondDSR bool
+
+	// exited is closed once the agent process has been reaped, readDone
+	// once all output has been read from the PTY.
+	exited   chan struct{}
+	readDone chan struct{}
+
+	recorder Recorder
+
+	// history keeps recent output for clients that attach late. It is
+	// guarded by handlersMu, under which output is also dispatched.
+	history     *ringbuf.Buffer
+	historySize int
+}
+
+// DefaultHistorySize is how much recent output a proxy keeps for late
+// joiners unless changed with SetHistorySize.
+const DefaultHistorySize = 256 * 1024
+
+// Recorder receives everything that passes through a proxy: program output,
+// user input and terminal size changes.
+type Recorder interface {
+	Output(data []byte)
+	Input(data []byte)
+	Resize(cols, rows int)
 }
 
 func NewProxy(command string, args ...string) *Proxy {
@@ -65,6 +92,8 @@ func NewProxy(command string, args ...string) *Proxy {
 		args:    args,
 		env:     []string{},
 		status:  StatusStopped,
+
+		historySize: DefaultHistorySize,
 	}
 }
 
@@ -72,6 +101,12 @@ func (p *Proxy) SetEnv(env []string) {
 	p.env = env
 }
 
+// SetDir sets the working directory of the agent process.
+// An empty dir runs the agent in ac2's working directory.
+func (p *Proxy) SetDir(dir string) {
+	p.dir = dir
+}
+
 func (p *Proxy) SetOutputHandler(handler func([]byte)) {
 	p.onOutput = handler
 }
@@ -80,6 +115,23 @@ func (p *Proxy) SetExitHandler(handler func(error)) {
 	p.onExit = handler
 }
 
+// SetResizeHandler is called with the new size whenever the PTY is resized,
+// including the initial size passed to Start.
+func (p *Proxy) SetResizeHandler(handler func(cols, rows int)) {
+	p.onResize = handler
+}
+
+// SetRecorder records the session to rec. It must be called before Start.
+func (p *Proxy) SetRecorder(rec Recorder) {
+	p.recorder = rec
+}
+
+// SetHistorySize sets how many bytes of recent output are kept for
+// WithHistory; zero disables the history. It must be called before Start.
+func (p *Proxy) SetHistorySize(size int) {
+	p.historySize = size
+}
+
 func (p *Proxy) SetAutoRespondDSR(enable bool) {
 	p.autoRespondDSR = enable
 }
@@ -97,6 +149,58 @@ func (p *Proxy) AddOutputHandler(id string, handler func([]byte)) {
 	}
 }
 
+// AddOutputHandlerWithHistory registers handler like AddOutputHandler, but
+// first passes it the recent output history, so nothing is lost or repeated
+// in between. handler must not block while receiving the history.
+func (p *Proxy) AddOutputHandlerWithHistory(id string, handler func([]byte)) {
+	p.handlersMu.Lock()
+	defer p.handlersMu.Unlock()
+
+	if history := p.historyLocked(); len(history) > 0 {
+		handler(history)
+	}
+	if p.handlers == nil {
+		p.handlers = make(map[string]*OutputHandler)
+	}
+	p.handlers[id] = &OutputHandler{
+		id:      id,
+		handler: handler,
+	}
+}
+
+// WithHistory calls fn with the recent output history while no new output
+// is dispatched, letting callers hand the history to clients of an existing
+// handler without gaps. fn must not block or call other handler methods.
+func (p *Proxy) WithHistory(fn func(history []byte)) {
+	p.handlersMu.Lock()
+	defer p.handlersMu.Unlock()
+	fn(p.historyLocked())
+}
+
+// History returns the recent output kept for late joiners. Once older
+// output has been discarded, it starts at a line boundary so it does not
+// begin in the middle of an escape sequence.
+func (p *Proxy) History() []byte {
+	p.handlersMu.RLock()
+	defer p.handlersMu.RUnlock()
+	return p.historyLocked()
+}
+
+// historyLocked is History for callers that hold p.handlersMu.
+func (p *Proxy) historyLocked() []byte {
+	if p.history == nil {
+		return nil
+	}
+
+	data := p.history.Bytes()
+	if p.history.Dropped() > 0 {
+		if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+			data = data[idx+1:]
+		}
+	}
+	return data
+}
+
 func (p *Proxy) RemoveOutputHandler(id string) {
 	p.handlersMu.Lock()
 	defer p.handlersMu.Unlock()
@@ -108,7 +212,16 @@ func (p *Proxy) Start(size *pty.Winsize) error {
 	defer p.mu.Unlock()
 
 	p.status = StatusStarting
+	p.exited = make(chan struct{})
+	p.readDone = make(chan struct{})
+	p.handlersMu.Lock()
+	p.history = nil
+	if p.historySize > 0 {
+		p.history = ringbuf.New(p.historySize)
+	}
+	p.handlersMu.Unlock()
 	p.cmd = exec.Command(p.command, p.args...)
+	p.cmd.Dir = p.dir
 	p.cmd.Env = append(os.Environ(), "TERM=xterm-256color")
 	p.cmd.Env = append(p.cmd.Env, p.env...)
 
@@ -123,6 +236,14 @@ func (p *Proxy) Start(size *pty.Winsize) error {
 		p.status = StatusError
 		return err
 	}
+	if size != nil {
+		if p.recorder != nil {
+			p.recorder.Resize(int(size.Cols), int(size.Rows))
+		}
+		if p.onResize != nil {
+			p.onResize(int(size.Cols), int(size.Rows))
+		}
+	}
 
 	p.status = StatusRunning
 
@@ -133,6 +254,7 @@ func (p *Proxy) Start(size *pty.Winsize) error {
 }
 
 func (p *Proxy) readLoop() {
+	defer close(p.readDone)
 	buf := make([]byte, 4096)
 	dsr := []byte("\x1b[6n")
 	dsrPrivate := []byte("\x1b[?6n")
@@ -148,6 +270,9 @@ func (p *Proxy) readLoop() {
 		if n > 0 {
 			data := make([]byte, n)
 			copy(data, buf[:n])
+			if p.recorder != nil {
+				p.recorder.Output(data)
+			}
 			if p.autoRespondDSR && (bytes.Contains(data, dsr) || bytes.Contains(data, dsrPrivate)) {
 				_, _ = p.ptmx.Write(dsrReply)
 			}
@@ -157,8 +282,12 @@ func (p *Proxy) readLoop() {
 				p.onOutput(data)
 			}
 
-			// Broadcast to all registered handlers
+			// Record history and broadcast under the same lock so
+			// AddOutputHandlerWithHistory sees each chunk exactly once
 			p.handlersMu.RLock()
+			if p.history != nil {
+				_, _ = p.history.Write(data)
+			}
 			for _, h := range p.handlers {
 				dataCopy := make([]byte, len(data))
 				copy(dataCopy, data)
@@ -171,6 +300,14 @@ func (p *Proxy) readLoop() {
 
 func (p *Proxy) waitLoop() {
 	err := p.cmd.Wait()
+	close(p.exited)
+
+	// Deliver what the agent printed right before exiting. Descendants still
+	// holding the PTY open would keep readLoop alive, so don't wait forever.
+	select {
+	case <-p.readDone:
+	case <-time.After(500 * time.Millisecond):
+	}
 	p.mu.Lock()
 	p.status = StatusStopped
 	p.mu.Unlock()
@@ -184,6 +321,9 @@ func (p *Proxy) Write(data []byte) (int, error) {
 	if p.ptmx == nil {
 		return 0, io.ErrClosedPipe
 	}
+	if p.recorder != nil {
+		p.recorder.Input(data)
+	}
 	return p.ptmx.Write(data)
 }
 
@@ -198,37 +338,42 @@ func (p *Proxy) Resize(rows, cols uint16) error {
 	if p.ptmx == nil {
 		return nil
 	}
+	if p.recorder != nil {
+		p.recorder.Resize(int(cols), int(rows))
+	}
+	if p.onResize != nil {
+		p.onResize(int(cols), int(rows))
+	}
 	return pty.Setsize(p.ptmx, &pty.Winsize{
 		Rows: rows,
 		Cols: cols,
 	})
 }
 
+// Stop terminates the agent together with every process it spawned,
+// escalating from SIGTERM to SIGKILL if the group does not exit in time.
 func (p *Proxy) Stop() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	if p.cmd != nil && p.cmd.Process != nil {
-		logger.Printf("Proxy.Stop: attempting graceful shutdown with SIGTERM for PID %d", p.cmd.Process.Pid)
+		pid := p.cmd.Process.Pid
+		logger.Printf("Proxy.Stop: attempting graceful shutdown with SIGTERM for process group %d", pid)
 
 		// Try graceful shutdown with SIGTERM first
-		if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		if err := signalGroup(p.cmd.Process, syscall.SIGTERM); err != nil {
 			logger.Printf("Proxy.Stop: SIGTERM failed: %v, will use SIGKILL", err)
-			_ = p.cmd.Process.Kill()
+			_ = signalGroup(p.cmd.Process, syscall.SIGKILL)
 		} else {
-			// Wait up to 1 second for graceful exit
-			done := make(chan error, 1)
-			go func() {
-				_, err := p.cmd.Process.Wait()
-				done <- err
-			}()
-
+			// The process is reaped by waitLoop; wait for it to finish
 			select {
-			case <-done:
+			case <-p.exited:
 				logger.Printf("Proxy.Stop: process exited gracefully")
 			case <-time.After(3 * time.Second):
 				logger.Printf("Proxy.Stop: graceful shutdown timeout, forcing with SIGKILL")
-				_ = p.cmd.Process.Kill()
+				// The leader is not reaped yet, so its group ID still
+				// belongs to this agent
+				_ = signalGroup(p.cmd.Process, syscall.SIGKILL)
 			}
 		}
 	}
@@ -240,6 +385,16 @@ func (p *Proxy) Stop() error {
 	return nil
 }
 
+// Close releases the terminal of an agent that has already exited.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ptmx == nil {
+		return nil
+	}
+	return p.ptmx.Close()
+}
+
 func (p *Proxy) Status() Status {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
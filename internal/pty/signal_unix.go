@@ -0,0 +1,14 @@
+//go:build unix
+
+package pty
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalGroup signals the agent's whole process group. pty.Start makes the
+// agent a session leader, so its pid is also its process group id.
+func signalGroup(proc *os.Process, sig syscall.Signal) error {
+	return syscall.Kill(-proc.Pid, sig)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package pty
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalGroup signals the agent process. Windows cannot signal a process
+// tree, so only the direct child is reached.
+func signalGroup(proc *os.Process, sig syscall.Signal) error {
+	return proc.Signal(sig)
+}
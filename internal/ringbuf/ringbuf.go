@@ -0,0 +1,133 @@
+package ringbuf
+
+import (
+	"io"
+	"sync"
+)
+
+// Buffer keeps the most recent bytes written to it, up to a fixed size.
+// It is safe for concurrent use.
+type Buffer struct {
+	mu      sync.Mutex
+	data    []byte
+	start   int // index of the oldest byte
+	length  int
+	written int64
+	spill   io.Writer
+}
+
+// New returns a buffer holding at most size bytes.
+func New(size int) *Buffer {
+	if size < 1 {
+		size = 1
+	}
+	return &Buffer{data: make([]byte, size)}
+}
+
+// SetSpill makes the buffer write bytes to w, oldest first, as they are
+// discarded to make room. Errors from w are ignored.
+func (b *Buffer) SetSpill(w io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spill = w
+}
+
+// Write appends p, discarding the oldest bytes once the buffer is full.
+// It never fails.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	b.written += int64(n)
+	size := len(b.data)
+	if len(p) > size {
+		b.discard(b.length)
+		b.spillBytes(p[:len(p)-size])
+		p = p[len(p)-size:]
+	}
+	if over := b.length + len(p) - size; over > 0 {
+		b.discard(over)
+	}
+
+	end := (b.start + b.length) % size
+	copied := copy(b.data[end:], p)
+	copy(b.data, p[copied:])
+	b.length += len(p)
+	return n, nil
+}
+
+// discard drops the n oldest bytes, spilling them first. Callers must hold
+// b.mu.
+func (b *Buffer) discard(n int) {
+	if b.spill != nil {
+		first := min(n, len(b.data)-b.start)
+		b.spillBytes(b.data[b.start : b.start+first])
+		b.spillBytes(b.data[:n-first])
+	}
+	b.start = (b.start + n) % len(b.data)
+	b.length -= n
+}
+
+func (b *Buffer) spillBytes(p []byte) {
+	if b.spill != nil && len(p) > 0 {
+		_, _ = b.spill.Write(p)
+	}
+}
+
+// Bytes returns a copy of the buffered bytes, oldest first.
+func (b *Buffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last(b.length)
+}
+
+// Tail returns a copy of at most the n newest bytes.
+func (b *Buffer) Tail(n int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last(min(max(n, 0), b.length))
+}
+
+// Written returns the total number of bytes ever written, which serves as an
+// offset for Since.
+func (b *Buffer) Written() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.written
+}
+
+// Since returns the bytes written after offset, as far as they are still
+// buffered.
+func (b *Buffer) Since(offset int64) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.written - offset
+	if n <= 0 {
+		return nil
+	}
+	return b.last(int(min(n, int64(b.length))))
+}
+
+// last copies the n newest bytes. Callers must hold b.mu.
+func (b *Buffer) last(n int) []byte {
+	out := make([]byte, n)
+	from := (b.start + b.length - n) % len(b.data)
+	copied := copy(out, b.data[from:min(from+n, len(b.data))])
+	copy(out[copied:], b.data[:n-copied])
+	return out
+}
+
+// Len returns the number of buffered bytes.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.length
+}
+
+// Dropped returns how many bytes have been discarded to make room.
+func (b *Buffer) Dropped() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.written - int64(b.length)
+}
@@ -0,0 +1,83 @@
+package ringbuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferKeepsNewestBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		writes []string
+		want   string
+	}{
+		{"empty", 4, nil, ""},
+		{"fits", 8, []string{"abc", "de"}, "abcde"},
+		{"exactly full", 4, []string{"ab", "cd"}, "abcd"},
+		{"wraps", 4, []string{"abc", "def"}, "cdef"},
+		{"wraps twice", 3, []string{"ab", "cd", "ef", "g"}, "efg"},
+		{"larger than buffer", 3, []string{"a", "bcdefg"}, "efg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.size)
+			total := 0
+			for _, w := range tt.writes {
+				n, err := b.Write([]byte(w))
+				if err != nil || n != len(w) {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+				total += len(w)
+			}
+			if got := string(b.Bytes()); got != tt.want {
+				t.Fatalf("Bytes() = %q, want %q", got, tt.want)
+			}
+			if b.Len() != len(tt.want) {
+				t.Fatalf("Len() = %d, want %d", b.Len(), len(tt.want))
+			}
+			if b.Written() != int64(total) || b.Dropped() != int64(total-len(tt.want)) {
+				t.Fatalf("Written() = %d, Dropped() = %d", b.Written(), b.Dropped())
+			}
+		})
+	}
+}
+
+func TestBufferSpillsDiscardedBytesInOrder(t *testing.T) {
+	var spilled bytes.Buffer
+	b := New(4)
+	b.SetSpill(&spilled)
+	for _, w := range []string{"abc", "def", "ghijklm", "n"} {
+		_, _ = b.Write([]byte(w))
+	}
+	if got := spilled.String() + string(b.Bytes()); got != "abcdefghijklmn" {
+		t.Fatalf("spilled+buffered = %q", got)
+	}
+	if spilled.Len() != int(b.Dropped()) {
+		t.Fatalf("spilled %d bytes, dropped %d", spilled.Len(), b.Dropped())
+	}
+}
+
+func TestBufferTailAndSince(t *testing.T) {
+	b := New(5)
+	_, _ = b.Write([]byte("abc"))
+	offset := b.Written()
+	_, _ = b.Write([]byte("defg"))
+
+	if got := string(b.Tail(2)); got != "fg" {
+		t.Fatalf("Tail(2) = %q", got)
+	}
+	if got := string(b.Tail(10)); got != "cdefg" {
+		t.Fatalf("Tail(10) = %q", got)
+	}
+	if got := string(b.Since(offset)); got != "defg" {
+		t.Fatalf("Since(offset) = %q", got)
+	}
+	// Output before the buffered window is gone
+	if got := string(b.Since(0)); got != "cdefg" {
+		t.Fatalf("Since(0) = %q", got)
+	}
+	if got := b.Since(b.Written()); got != nil {
+		t.Fatalf("Since(Written()) = %q, want nil", got)
+	}
+}
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/biliqiqi/ac2/internal/pool"
 	"github.com/biliqiqi/ac2/internal/webterm"
@@ -16,12 +17,23 @@ const (
 	ActionResume
 	ActionQuit
 	ActionSwitch
+	ActionNew
+	ActionRestart
 )
 
+// Action is the result of a control mode session. ActionSwitch with AgentID
+// attaches to a running instance, while ActionSwitch with TargetAgentType
+// replaces the current agent. ActionNew starts another instance of
+// TargetAgentType alongside the running ones. ActionRestart replaces the
+// stopped instance AgentID with a new one.
 type Action struct {
 	Type            ActionType
 	AgentID         string
 	TargetAgentType string
+	Label           string
+	WorkDir         string
+	Args            []string
+	Env             []string
 }
 
 type ControlMode struct {
@@ -84,7 +96,7 @@ func (c *ControlMode) buildUI() tview.Primitive {
 
 	clientsList := c.buildClientsList()
 
-	canResume := c.currentAgent != nil && c.currentAgent.Status == pool.StatusRunning
+	canResume := c.currentAgent != nil && c.currentAgent.Status() == pool.StatusRunning
 	menuBar := tview.NewTextView()
 	menuBar.SetDynamicColors(true)
 	menuBar.SetTextAlign(tview.AlignCenter)
@@ -95,11 +107,11 @@ func (c *ControlMode) buildUI() tview.Primitive {
 	if canResume {
 		resumeLabel = "[white]r Resume[-]"
 	}
-	menuBar.SetText(fmt.Sprintf("%s   [white]s Switch Agent[-]   [white]f Refresh[-]   [white]d Disconnect Client[-]   [white]h Help[-]   [white]q Quit[-]", resumeLabel))
+	menuBar.SetText(fmt.Sprintf("%s   [white]s Switch Agent[-]   [white]n New Instance[-]   [white]f Refresh[-]   [white]d Disconnect Client[-]   [white]h Help[-]   [white]q Quit[-]", resumeLabel))
 
 	// Layout
 	flex := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(statusView, 3, 0, false).
+		AddItem(statusView, strings.Count(statusView.GetText(false), "\n")+2, 0, false).
 		AddItem(clientsList, 0, 1, true).
 		AddItem(menuBar, 3, 0, false)
 
@@ -116,6 +128,9 @@ func (c *ControlMode) buildUI() tview.Primitive {
 			case 's', 'S':
 				c.showSwitchAgentMenu()
 				return nil
+			case 'n', 'N':
+				c.showNewInstanceForm()
+				return nil
 			case 'd', 'D':
 				c.disconnectSelectedClient()
 				return nil
@@ -149,15 +164,27 @@ func (c *ControlMode) buildUI() tview.Primitive {
 func (c *ControlMode) buildStatusText() string {
 	name := "Unknown"
 	if c.currentAgent != nil {
-		if c.currentAgent.Name != "" {
-			name = c.currentAgent.Name
-		} else if c.currentAgent.Type != "" {
-			name = c.currentAgent.Type
-		} else if c.currentAgent.ID != "" {
-			name = c.currentAgent.ID
+		name = c.currentAgent.DisplayName()
+	}
+
+	running := 0
+	for _, agent := range c.agentPool.ListAll() {
+		if agent.Status == pool.StatusRunning {
+			running++
 		}
 	}
-	return fmt.Sprintf(" Current Agent: [white::b]%s[-]\n", name)
+	text := fmt.Sprintf(" Current Agent: [white::b]%s[-]   [gray]Running instances: %d[-]", tview.Escape(name), running)
+	if c.currentAgent != nil {
+		if restarts := c.currentAgent.Restarts(); restarts > 0 || c.currentAgent.Status() == pool.StatusRestarting {
+			text += fmt.Sprintf("   [yellow]%s, restarts: %d[-]", c.currentAgent.Status(), restarts)
+		}
+	}
+	if c.passthrough != nil {
+		if notice := c.passthrough.LastRestart(); notice != "" {
+			text += fmt.Sprintf("\n [gray]Last restart event: %s[-]", tview.Escape(notice))
+		}
+	}
+	return text + "\n"
 }
 
 func (c *ControlMode) buildClientsList() *tview.List {
@@ -192,10 +219,16 @@ func (c *ControlMode) buildClientsList() *tview.List {
 		if label == "" {
 			label = "Unknown"
 		}
+		if client.Role != "" {
+			label = fmt.Sprintf("%s (%s)", label, client.Role)
+		}
 		secondary := client.UserAgent
 		if secondary == "" {
 			secondary = "Unknown User Agent"
 		}
+		if client.AgentID != "" {
+			secondary = fmt.Sprintf("%s · %s", client.AgentID, secondary)
+		}
 		c.clientIDs = append(c.clientIDs, clientID)
 		c.clientInfo[clientID] = client
 		list.AddItem(label, secondary, 0, func() {
@@ -205,7 +238,7 @@ func (c *ControlMode) buildClientsList() *tview.List {
 
 	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEscape {
-			if c.currentAgent != nil && c.currentAgent.Status == pool.StatusRunning {
+			if c.currentAgent != nil && c.currentAgent.Status() == pool.StatusRunning {
 				c.action = Action{Type: ActionResume}
 				c.app.Stop()
 				return nil
@@ -224,13 +257,50 @@ func (c *ControlMode) showSwitchAgentMenu() {
 	list := tview.NewList()
 	list.SetBorder(true)
 	list.SetTitle(" Switch Agent ")
-	list.ShowSecondaryText(false)
+	list.ShowSecondaryText(true)
+
+	// Running instances can be attached without stopping the current agent
+	for _, agent := range c.agentPool.ListAll() {
+		if agent.Status != pool.StatusRunning {
+			continue
+		}
+		if c.currentAgent != nil && agent.ID == c.currentAgent.ID {
+			continue
+		}
+		agentID := agent.ID
+		secondary := "Attach to running instance"
+		if agent.Label != "" {
+			secondary = fmt.Sprintf("Attach to running instance (%s)", agent.Label)
+		}
+		list.AddItem(fmt.Sprintf("%s (%s)", agent.Name, agentID), tview.Escape(secondary), 0, func() {
+			c.action = Action{
+				Type:    ActionSwitch,
+				AgentID: agentID,
+			}
+			c.app.Stop()
+		})
+	}
+
+	// Stopped or crashed instances start again with their launch options
+	for _, agent := range c.agentPool.ListAll() {
+		if agent.Status != pool.StatusStopped && agent.Status != pool.StatusError {
+			continue
+		}
+		agentID := agent.ID
+		list.AddItem(fmt.Sprintf("%s (%s)", agent.Name, agentID), fmt.Sprintf("Restart %s instance", agent.Status), 0, func() {
+			c.action = Action{
+				Type:    ActionRestart,
+				AgentID: agentID,
+			}
+			c.app.Stop()
+		})
+	}
 
 	available := c.agentPool.GetAvailableAgents()
 	for _, agent := range available {
 		agentType := string(agent.Type)
 		name := agent.Name
-		list.AddItem(name, "", 0, func() {
+		list.AddItem(name, "Replace current agent", 0, func() {
 			c.action = Action{
 				Type:            ActionSwitch,
 				TargetAgentType: agentType,
@@ -252,6 +322,57 @@ func (c *ControlMode) showSwitchAgentMenu() {
 	c.app.SetRoot(list, true)
 }
 
+func (c *ControlMode) showNewInstanceForm() {
+	available := c.agentPool.GetAvailableAgents()
+	if len(available) == 0 {
+		c.showError("No agents available")
+		return
+	}
+
+	names := make([]string, 0, len(available))
+	for _, agent := range available {
+		names = append(names, agent.Name)
+	}
+
+	form := tview.NewForm()
+	form.SetBorder(true)
+	form.SetTitle(" New Instance ")
+	form.AddDropDown("Agent", names, 0, nil)
+	form.AddInputField("Label", "", 30, nil, nil)
+	form.AddInputField("Directory", "", 50, nil, nil)
+	form.AddInputField("Args", "", 50, nil, nil)
+	form.AddInputField("Env (KEY=VALUE ...)", "", 50, nil, nil)
+	form.AddButton("Start", func() {
+		index, _ := form.GetFormItemByLabel("Agent").(*tview.DropDown).GetCurrentOption()
+		if index < 0 || index >= len(available) {
+			return
+		}
+		text := func(label string) string {
+			return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+		}
+		c.action = Action{
+			Type:            ActionNew,
+			TargetAgentType: string(available[index].Type),
+			Label:           text("Label"),
+			WorkDir:         text("Directory"),
+			Args:            strings.Fields(text("Args")),
+			Env:             strings.Fields(text("Env (KEY=VALUE ...)")),
+		}
+		c.app.Stop()
+	})
+	form.AddButton("Cancel", func() {
+		c.restoreMenuCapture()
+		c.app.SetRoot(c.buildUI(), true)
+	})
+	form.SetCancelFunc(func() {
+		c.restoreMenuCapture()
+		c.app.SetRoot(c.buildUI(), true)
+	})
+
+	c.suspendMenuCapture()
+	c.app.SetRoot(form, true)
+}
+
 func (c *ControlMode) disconnectSelectedClient() {
 	if len(c.clientIDs) == 0 {
 		return
@@ -394,13 +515,14 @@ func (c *ControlMode) handleQuit() {
 func (c *ControlMode) showHelp() {
 	help := "" +
 		"Resume: back to current agent\n" +
-		"Switch Agent: switch current agent to another\n" +
+		"Switch Agent: attach to a running instance, restart a stopped one or replace current agent\n" +
+		"New Instance: start another instance with optional label, directory, args and env\n" +
 		"Web Clients: select and press Enter to disconnect\n" +
 		"Disconnect Client: press d to disconnect selected client\n" +
 		"Refresh: reload web client list\n" +
 		"Help: show this help menu\n" +
 		"Quit: exit ac2\n\n" +
-		"Shortcuts: r/s/f/d/h/q, Esc: back (when resume is available)"
+		"Shortcuts: r/s/n/f/d/h/q, Esc: back (when resume is available)"
 
 	modal := tview.NewModal()
 	back := c.buildUI()
@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/biliqiqi/ac2/internal/control"
 	"github.com/biliqiqi/ac2/internal/logger"
 	"github.com/biliqiqi/ac2/internal/pool"
 	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
@@ -25,8 +26,8 @@ const (
 
 type Passthrough struct {
 	agentPool    *pool.AgentPool
+	controller   *control.Controller
 	currentAgent *pool.AgentInstance
-	mainAgent    *pool.AgentInstance
 
 	mcpSocketPath string
 	webServer     WebTerminalServer
@@ -40,7 +41,15 @@ type Passthrough struct {
 	exitWatchStop chan struct{}
 
 	inputPaused bool
-	switching   bool
+
+	// attachMu serializes attaching agents to the local terminal.
+	// attachPending is set while control mode holds the terminal and the
+	// current agent still waits to be attached, see resumeInput.
+	attachMu      sync.Mutex
+	attachPending bool
+
+	// lastRestart is the latest restart notice, shown in control mode.
+	lastRestart string
 }
 
 type WebTerminalServer interface {
@@ -48,17 +57,18 @@ type WebTerminalServer interface {
 	SetActiveSource(source string)
 	SetAgentName(name string)
 	SetProxy(proxy *ptyproxy.Proxy)
+	SetLocalSize(cols, rows uint16)
 	BroadcastReset()
 	ListClients() []webterm.ClientInfo
 	DisconnectClient(id string) error
 	Stop() error
 }
 
-func NewPassthrough(agentPool *pool.AgentPool, mainAgent *pool.AgentInstance, mcpSocketPath string, webServer WebTerminalServer) *Passthrough {
+func NewPassthrough(agentPool *pool.AgentPool, controller *control.Controller, mcpSocketPath string, webServer WebTerminalServer) *Passthrough {
 	return &Passthrough{
 		agentPool:     agentPool,
-		currentAgent:  mainAgent,
-		mainAgent:     mainAgent,
+		controller:    controller,
+		currentAgent:  controller.Current(),
 		mcpSocketPath: mcpSocketPath,
 		webServer:     webServer,
 		quit:          make(chan struct{}),
@@ -66,7 +76,7 @@ func NewPassthrough(agentPool *pool.AgentPool, mainAgent *pool.AgentInstance, mc
 }
 
 func (p *Passthrough) Run() error {
-	if p.mainAgent == nil {
+	if p.controller.Main() == nil {
 		return fmt.Errorf("no main agent provided")
 	}
 
@@ -84,6 +94,10 @@ func (p *Passthrough) Run() error {
 	p.currentAgent.SetOutputSink(os.Stdout)
 
 	p.startExitWatcher(p.currentAgent)
+	p.agentPool.AddRestartHandler(p.handleRestart)
+	p.controller.OnAttach(p.attachAgent)
+	p.controller.SetQuitHandler(p.stop)
+	p.resizeAgent(p.current())
 
 	// Handle window resize
 	sigwinch := make(chan os.Signal, 1)
@@ -160,9 +174,17 @@ func (p *Passthrough) Run() error {
 }
 
 func (p *Passthrough) printBanner() {
-	// Gray colored hint, will scroll away as agent outputs
-	fmt.Printf("\033[90m[ac2] Ctrl+\\ control mode │ Ctrl+Q quit │ Current: %s\033[0m\n",
-		p.currentAgent.Name)
+	// Gray colored hint, will scroll away as agent outputs. It uses \r\n
+	// since web terminal switches print it while in raw mode.
+	fmt.Printf("\r\033[90m[ac2] Ctrl+\\ control mode │ Ctrl+Q quit │ Current: %s\033[0m\r\n",
+		p.current().DisplayName())
+}
+
+// current returns the agent that receives local terminal input.
+func (p *Passthrough) current() *pool.AgentInstance {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.currentAgent
 }
 
 func (p *Passthrough) readLoop() {
@@ -210,8 +232,8 @@ func (p *Passthrough) readLoop() {
 				// Flush accumulated bytes to CURRENT agent
 				if i > start {
 					p.mu.Lock()
-					if p.currentAgent != nil && p.currentAgent.Proxy != nil {
-						_, _ = p.currentAgent.Proxy.Write(buf[start:i])
+					if p.currentAgent != nil && p.currentAgent.Proxy() != nil {
+						_, _ = p.currentAgent.Proxy().Write(buf[start:i])
 					}
 					p.mu.Unlock()
 				}
@@ -233,9 +255,12 @@ func (p *Passthrough) readLoop() {
 
 		// Flush remaining bytes to CURRENT (potentially new) agent
 		if start < n {
+			if p.webServer != nil {
+				p.webServer.SetActiveSource("local")
+			}
 			p.mu.Lock()
-			if p.currentAgent != nil && p.currentAgent.Proxy != nil {
-				_, _ = p.currentAgent.Proxy.Write(buf[start:n])
+			if p.currentAgent != nil && p.currentAgent.Proxy() != nil {
+				_, _ = p.currentAgent.Proxy().Write(buf[start:n])
 			}
 			p.mu.Unlock()
 		}
@@ -249,17 +274,28 @@ func (p *Passthrough) handleResize(sigwinch chan os.Signal) {
 			return
 		case <-sigwinch:
 			p.mu.Lock()
-			if p.currentAgent != nil && p.currentAgent.Proxy != nil {
-				cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
-				if err == nil {
-					_ = p.currentAgent.Proxy.Resize(uint16(rows), uint16(cols))
-				}
+			if p.currentAgent != nil && p.currentAgent.Proxy() != nil {
+				p.resizeAgent(p.currentAgent)
 			}
 			p.mu.Unlock()
 		}
 	}
 }
 
+// resizeAgent sizes agent for the local terminal. With a web server the
+// size goes through its size policy, which also weighs the web viewers.
+func (p *Passthrough) resizeAgent(agent *pool.AgentInstance) {
+	cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return
+	}
+	if p.webServer != nil {
+		p.webServer.SetLocalSize(uint16(cols), uint16(rows))
+		return
+	}
+	_ = agent.Proxy().Resize(uint16(rows), uint16(cols))
+}
+
 func (p *Passthrough) enterControlMode() {
 	p.mu.Lock()
 	p.inputPaused = true
@@ -271,7 +307,7 @@ func (p *Passthrough) enterControlMode() {
 	}
 
 	// Show control menu
-	ctrl := NewControlMode(p.agentPool, p.currentAgent, p)
+	ctrl := NewControlMode(p.agentPool, p.current(), p)
 	action := ctrl.Run()
 
 	// Handle action
@@ -285,9 +321,7 @@ func (p *Passthrough) enterControlMode() {
 	if err != nil {
 		p.stop()
 	}
-	p.mu.Lock()
-	p.inputPaused = false
-	p.mu.Unlock()
+	p.resumeInput()
 }
 
 func (p *Passthrough) confirmQuit() bool {
@@ -301,7 +335,7 @@ func (p *Passthrough) confirmQuit() bool {
 	}
 
 	// Show quit confirmation
-	ctrl := NewControlMode(p.agentPool, p.currentAgent, p)
+	ctrl := NewControlMode(p.agentPool, p.current(), p)
 	action := ctrl.RunExitConfirm()
 
 	if p.handleControlAction(action) {
@@ -315,94 +349,102 @@ func (p *Passthrough) confirmQuit() bool {
 		p.stop()
 		return true
 	}
-	p.mu.Lock()
-	p.inputPaused = false
-	p.mu.Unlock()
+	p.resumeInput()
 	return false
 }
 
 func (p *Passthrough) handleControlAction(action Action) bool {
 	switch action.Type {
 	case ActionQuit:
-		p.stop()
+		p.controller.Quit()
 		return true
 	case ActionSwitch:
-		p.mu.Lock()
-		p.switching = true
-		logger.Printf("ActionSwitch: acquired lock, switching=true")
-		p.mu.Unlock()
-
-		fmt.Println("\n\033[36mSwitching agents... please wait...\033[0m")
-
-		p.stopExitWatcher()
-
-		// Stop current agent
-		if p.currentAgent != nil && p.currentAgent.Proxy != nil {
-			logger.Printf("ActionSwitch: stopping current agent %s", p.currentAgent.ID)
-
-			// Mark as stopped immediately to prevent reuse if switching to same type
-			p.currentAgent.Status = pool.StatusStopped
-			_ = p.currentAgent.Proxy.Stop()
-
-			// Wait for agent process to truly exit
-			startWait := time.Now()
-			for {
-				if p.currentAgent.Proxy.Status() == ptyproxy.StatusStopped {
-					logger.Printf("ActionSwitch: agent %s stopped gracefully", p.currentAgent.ID)
-					break
-				}
-				if time.Since(startWait) > 3*time.Second {
-					logger.Printf("ActionSwitch: timed out waiting for agent %s to stop", p.currentAgent.ID)
-					break
-				}
-				time.Sleep(50 * time.Millisecond)
+		if action.AgentID != "" {
+			if _, err := p.controller.Switch(action.AgentID); err != nil {
+				logger.Printf("ActionSwitch: %v", err)
 			}
+			return false
 		}
 
-		// Start new agent
-		logger.Printf("ActionSwitch: starting new agent %s", action.TargetAgentType)
-		agent, err := p.agentPool.GetOrCreate(action.TargetAgentType)
-		if err != nil {
+		fmt.Println("\n\033[36mSwitching agents... please wait...\033[0m")
+		if _, err := p.controller.Replace(action.TargetAgentType); err != nil {
 			logger.Printf("Failed to switch agent: %v", err)
-			p.mu.Lock()
-			p.switching = false
-			p.mu.Unlock()
 			p.stop()
 			return true
 		}
-
-		// Update main agent reference if we are replacing the main entry point
-		if p.mainAgent != nil && p.currentAgent != nil && p.mainAgent.ID == p.currentAgent.ID {
-			logger.Printf("ActionSwitch: updating main agent from %s to %s", p.mainAgent.ID, agent.ID)
-			p.mainAgent = agent
+	case ActionNew:
+		logger.Printf("ActionNew: starting new %s instance (label=%q)", action.TargetAgentType, action.Label)
+		_, err := p.controller.Start(action.TargetAgentType,
+			pool.WithLabel(action.Label),
+			pool.WithWorkDir(action.WorkDir),
+			pool.WithArgs(action.Args...),
+			pool.WithEnv(action.Env...),
+		)
+		if err != nil {
+			logger.Printf("Failed to start new instance: %v", err)
+			fmt.Printf("\n\033[31mFailed to start %s: %v\033[0m\n", action.TargetAgentType, err)
+			return false
+		}
+	case ActionRestart:
+		logger.Printf("ActionRestart: restarting %s", action.AgentID)
+		if _, err := p.controller.Restart(action.AgentID); err != nil {
+			logger.Printf("Failed to restart agent: %v", err)
+			fmt.Printf("\n\033[31mFailed to restart %s: %v\033[0m\n", action.AgentID, err)
 		}
+	}
 
-		p.currentAgent = agent
-		p.currentAgent.SetOutputSink(os.Stdout)
-		p.startExitWatcher(p.currentAgent)
+	return false
+}
 
-		logger.Printf("Switched to agent: %s", agent.Name)
-		p.printBanner()
+// attachAgent routes local terminal I/O to agent when the controller makes
+// it current, whether from control mode or the web terminal. While control
+// mode holds the terminal, the agent is only recorded as current and is
+// attached when control mode exits.
+func (p *Passthrough) attachAgent(agent *pool.AgentInstance) {
+	p.attachMu.Lock()
+	defer p.attachMu.Unlock()
 
-		// Trigger resize to ensure correct size
-		cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
-		if err == nil {
-			_ = p.currentAgent.Proxy.Resize(uint16(rows), uint16(cols))
-		}
+	p.mu.Lock()
+	previous := p.currentAgent
+	p.currentAgent = agent
+	paused := p.inputPaused
+	p.attachPending = paused
+	p.mu.Unlock()
+	if previous != nil && previous.ID != agent.ID {
+		previous.SetOutputSink(nil)
+	}
+	if paused {
+		return
+	}
+	p.connectAgent(agent)
+}
 
-		if p.webServer != nil {
-			p.webServer.SetProxy(agent.Proxy)
-			p.webServer.SetAgentName(agent.Name)
-			p.webServer.BroadcastReset()
-		}
+// connectAgent shows agent's output on the local terminal and watches it
+// for exit. Callers must hold p.attachMu.
+func (p *Passthrough) connectAgent(agent *pool.AgentInstance) {
+	agent.SetOutputSink(os.Stdout)
+	p.startExitWatcher(agent)
+	p.printBanner()
 
-		p.mu.Lock()
-		p.switching = false
-		logger.Printf("ActionSwitch: switch complete, switching=false")
-		p.mu.Unlock()
-	}
+	// Trigger resize to ensure correct size
+	p.resizeAgent(agent)
+}
 
-	return false
+// resumeInput hands the terminal back from control mode, first attaching
+// an agent that became current meanwhile.
+func (p *Passthrough) resumeInput() {
+	p.attachMu.Lock()
+	defer p.attachMu.Unlock()
+
+	p.mu.Lock()
+	p.inputPaused = false
+	pending := p.attachPending
+	p.attachPending = false
+	agent := p.currentAgent
+	p.mu.Unlock()
+	if pending && agent != nil {
+		p.connectAgent(agent)
+	}
 }
 
 func (p *Passthrough) restoreTerminal() {
@@ -450,14 +492,8 @@ func (p *Passthrough) stopExitWatcher() {
 
 func (p *Passthrough) handleAgentExit(agent *pool.AgentInstance, err error) {
 	logger.Printf("HandleAgentExit: agent=%s error=%v", agent.ID, err)
-	p.mu.Lock()
-	if p.switching {
-		logger.Printf("HandleAgentExit: ignoring exit due to switching flag")
-		p.mu.Unlock()
-		return
-	}
-	isCurrent := p.currentAgent != nil && p.currentAgent.ID == agent.ID
-	p.mu.Unlock()
+	// Agents stopped by a switch or restart are no longer current
+	isCurrent, isMain := p.controller.Settle(agent)
 
 	if err != nil {
 		logger.Printf("Agent exited with error: %s (%v)", agent.ID, err)
@@ -470,7 +506,7 @@ func (p *Passthrough) handleAgentExit(agent *pool.AgentInstance, err error) {
 		return
 	}
 
-	if p.mainAgent != nil && agent.ID == p.mainAgent.ID {
+	if isMain {
 		logger.Printf("HandleAgentExit: agent %s is main agent, but not stopping app; entering control mode", agent.ID)
 		// p.stop()
 		// return
@@ -479,39 +515,29 @@ func (p *Passthrough) handleAgentExit(agent *pool.AgentInstance, err error) {
 	p.enterControlMode()
 }
 
-func (p *Passthrough) SwitchToAgent(agentID string) error {
-	agent, err := p.agentPool.Get(agentID)
-	if err != nil {
-		return err
-	}
-
+// handleRestart reports restart activity on the local terminal and keeps a
+// restarted current agent at the terminal's size.
+func (p *Passthrough) handleRestart(event pool.RestartEvent) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Detach current agent output from stdout
-	if p.currentAgent != nil {
-		p.currentAgent.SetOutputSink(nil)
+	p.lastRestart = event.String()
+	paused := p.inputPaused
+	isCurrent := p.currentAgent != nil && p.currentAgent.ID == event.Instance.ID
+	p.mu.Unlock()
+	if !isCurrent {
+		return
 	}
 
-	p.currentAgent = agent
-
-	// Attach new agent output to stdout
-	agent.SetOutputSink(os.Stdout)
-	p.startExitWatcher(agent)
-
-	// Update banner
-	logger.Printf("Switched to: %s", agent.ID)
-	if p.webServer != nil {
-		name := agent.Name
-		if name == "" {
-			name = agent.Type
-		}
-		p.webServer.SetAgentName(name)
+	if event.Type == pool.RestartDone {
+		p.resizeAgent(event.Instance)
+	}
+	if !paused {
+		fmt.Printf("\r\n\033[33m[ac2] %s\033[0m\r\n", event)
 	}
-
-	return nil
 }
 
-func (p *Passthrough) SwitchToMain() error {
-	return p.SwitchToAgent(p.mainAgent.ID)
+// LastRestart returns the latest restart notice, if any.
+func (p *Passthrough) LastRestart() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastRestart
 }
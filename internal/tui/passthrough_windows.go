@@ -5,6 +5,7 @@ package tui
 import (
 	"fmt"
 
+	"github.com/biliqiqi/ac2/internal/control"
 	"github.com/biliqiqi/ac2/internal/pool"
 	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
 	"github.com/biliqiqi/ac2/internal/webterm"
@@ -12,8 +13,7 @@ import (
 
 type Passthrough struct {
 	agentPool     *pool.AgentPool
-	currentAgent  *pool.AgentInstance
-	mainAgent     *pool.AgentInstance
+	controller    *control.Controller
 	mcpSocketPath string
 	webServer     WebTerminalServer
 }
@@ -23,17 +23,17 @@ type WebTerminalServer interface {
 	SetActiveSource(source string)
 	SetAgentName(name string)
 	SetProxy(proxy *ptyproxy.Proxy)
+	SetLocalSize(cols, rows uint16)
 	BroadcastReset()
 	ListClients() []webterm.ClientInfo
 	DisconnectClient(id string) error
 	Stop() error
 }
 
-func NewPassthrough(agentPool *pool.AgentPool, mainAgent *pool.AgentInstance, mcpSocketPath string, webServer WebTerminalServer) *Passthrough {
+func NewPassthrough(agentPool *pool.AgentPool, controller *control.Controller, mcpSocketPath string, webServer WebTerminalServer) *Passthrough {
 	return &Passthrough{
 		agentPool:     agentPool,
-		currentAgent:  mainAgent,
-		mainAgent:     mainAgent,
+		controller:    controller,
 		mcpSocketPath: mcpSocketPath,
 		webServer:     webServer,
 	}
@@ -43,10 +43,6 @@ func (p *Passthrough) Run() error {
 	return fmt.Errorf("passthrough TUI mode is not supported on Windows, please use --no-tui flag for headless mode")
 }
 
-func (p *Passthrough) SwitchToAgent(agentID string) error {
-	return fmt.Errorf("not supported on Windows")
-}
-
-func (p *Passthrough) SwitchToMain() error {
-	return fmt.Errorf("not supported on Windows")
+func (p *Passthrough) LastRestart() string {
+	return ""
 }
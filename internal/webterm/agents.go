@@ -0,0 +1,195 @@
+package webterm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+// agentSummary is an agent instance in /api/agents responses.
+type agentSummary struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Label     string    `json:"label,omitempty"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+	Restarts  int       `json:"restarts"`
+	// Current is the agent that clients without ?agent= follow.
+	Current bool `json:"current"`
+}
+
+// agentType is an agent that can be started from the browser.
+type agentType struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type agentList struct {
+	Agents []agentSummary `json:"agents"`
+	Types  []agentType    `json:"types"`
+}
+
+// startAgentRequest is the body of POST /api/agents.
+type startAgentRequest struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	Dir   string `json:"dir"`
+	// Args are extra CLI arguments.
+	Args []string `json:"args"`
+	// Env overrides variables of the inherited environment.
+	Env map[string]string `json:"env"`
+}
+
+// handleAgents lists the pool's instances (GET) or starts a new one (POST).
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if s.agentPool == nil {
+		http.Error(w, "agent selection is not available", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.listAgents())
+	case http.MethodPost:
+		s.startAgent(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAgent stops an instance with DELETE /api/agents/<id>. Instances
+// backing an MCP session close their session instead.
+func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
+	if s.agentPool == nil {
+		http.Error(w, "agent selection is not available", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if requestRole(r) != RoleOperator {
+		http.Error(w, "viewers cannot stop agents", http.StatusForbidden)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/agents/")
+	agent, err := s.agentPool.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// The current agent keeps ac2 running; stopping it would end the session
+	if agent.Proxy() != nil && agent.Proxy() == s.currentProxy() {
+		http.Error(w, "cannot stop the current agent", http.StatusConflict)
+		return
+	}
+	// Stopping it would fail a delegated call half way, and no call may
+	// start while it stops
+	err = agent.IfIdle(func() error {
+		if sessionID, ok := s.agentPool.SessionOf(id); ok {
+			logger.Printf("WebTerm: closing session %s of agent %s from %s", sessionID, id, clientAddr(r.RemoteAddr))
+			return s.agentPool.CloseSession(sessionID)
+		}
+		logger.Printf("WebTerm: stopping agent %s from %s", id, clientAddr(r.RemoteAddr))
+		return s.agentPool.Stop(id)
+	})
+	switch {
+	case errors.Is(err, pool.ErrAgentBusy):
+		http.Error(w, "agent is answering an MCP call", http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) startAgent(w http.ResponseWriter, r *http.Request) {
+	if requestRole(r) != RoleOperator {
+		http.Error(w, "viewers cannot start agents", http.StatusForbidden)
+		return
+	}
+	var req startAgentRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	env := make([]string, 0, len(req.Env))
+	for key, value := range req.Env {
+		if key == "" || strings.Contains(key, "=") {
+			http.Error(w, fmt.Sprintf("invalid env name %q", key), http.StatusBadRequest)
+			return
+		}
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+
+	logger.Printf("WebTerm: starting %s instance (label=%q) from %s", req.Type, req.Label, clientAddr(r.RemoteAddr))
+	// No local terminal watches a new instance, so answer its cursor
+	// position queries
+	agent, err := s.agentPool.Create(req.Type,
+		pool.WithLabel(req.Label),
+		pool.WithWorkDir(req.Dir),
+		pool.WithArgs(req.Args...),
+		pool.WithEnv(env...),
+		pool.WithAutoRespondDSR(true),
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.summarize(pool.AgentInfo{
+		ID:        agent.ID,
+		Type:      agent.Type,
+		Name:      agent.Name,
+		Label:     agent.Label,
+		Status:    agent.Status(),
+		StartedAt: agent.StartedAt,
+	}))
+}
+
+func (s *Server) listAgents() agentList {
+	infos := s.agentPool.ListAll()
+	list := agentList{
+		Agents: make([]agentSummary, 0, len(infos)),
+		Types:  []agentType{},
+	}
+	for _, info := range infos {
+		list.Agents = append(list.Agents, s.summarize(info))
+	}
+	for _, available := range s.agentPool.GetAvailableAgents() {
+		list.Types = append(list.Types, agentType{Type: string(available.Type), Name: available.Name})
+	}
+	return list
+}
+
+func (s *Server) summarize(info pool.AgentInfo) agentSummary {
+	summary := agentSummary{
+		ID:        info.ID,
+		Type:      info.Type,
+		Name:      info.Name,
+		Label:     info.Label,
+		Status:    string(info.Status),
+		StartedAt: info.StartedAt,
+		Restarts:  info.Restarts,
+	}
+	if agent, err := s.agentPool.Get(info.ID); err == nil && agent.Proxy() != nil {
+		summary.Current = agent.Proxy() == s.currentProxy()
+	}
+	return summary
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
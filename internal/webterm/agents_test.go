@@ -0,0 +1,115 @@
+package webterm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+func newAgentsTestServer(t *testing.T) (*Server, *pool.AgentPool) {
+	t.Helper()
+	// cat exits on SIGTERM, unlike an interactive shell
+	agentPool := pool.NewAgentPool([]detector.AgentInfo{{Type: "cat", Name: "Cat", Command: "cat", Found: true}}, "")
+	t.Cleanup(func() { _ = agentPool.Shutdown() })
+	s := NewServer(0, "", "", "test")
+	s.SetAgentPool(agentPool)
+	return s, agentPool
+}
+
+func deleteAgent(s *Server, id string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodDelete, "/api/agents/"+id, nil)
+	w := httptest.NewRecorder()
+	s.handleAgent(w, withRole(r, RoleOperator))
+	return w
+}
+
+func TestDeleteAgentClosesSession(t *testing.T) {
+	s, agentPool := newAgentsTestServer(t)
+	agentPool.SetCompletionDetector("cat", &pool.PatternDetector{Quiet: 100 * time.Millisecond})
+	id, err := agentPool.CreateSession("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agentPool.CallSession(context.Background(), "cat", id, "hello", nil); err != nil {
+		t.Fatal(err)
+	}
+	sessions := agentPool.ListSessions()
+	if len(sessions) != 1 || sessions[0].InstanceID == "" {
+		t.Fatalf("session has no instance: %+v", sessions)
+	}
+
+	if w := deleteAgent(s, sessions[0].InstanceID); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE got %d: %s", w.Code, w.Body)
+	}
+	if sessions := agentPool.ListSessions(); len(sessions) != 0 {
+		t.Fatalf("session still open: %+v", sessions)
+	}
+}
+
+func TestDeleteAgentRefusesBusyAgent(t *testing.T) {
+	s, agentPool := newAgentsTestServer(t)
+	agent, err := agentPool.Create("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = agent.SendAndWait(ctx, "hello")
+	}()
+	for !agent.Busy() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if w := deleteAgent(s, agent.ID); w.Code != http.StatusConflict {
+		t.Fatalf("DELETE of a busy agent got %d, want %d", w.Code, http.StatusConflict)
+	}
+	cancel()
+	<-done
+	if w := deleteAgent(s, agent.ID); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE after the call got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestStartAgentOptions(t *testing.T) {
+	s, agentPool := newAgentsTestServer(t)
+	start := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/agents", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.handleAgents(w, withRole(r, RoleOperator))
+		return w
+	}
+
+	for _, body := range []string{
+		`{"type": "cat", "env": "FOO=bar"}`,
+		`{"type": "cat", "env": {"A=B": "1"}}`,
+		`{"type": "cat", "args": "-u"}`,
+	} {
+		if w := start(body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s got %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+	if w := start(`{"type": "cat", "args": ["-u"], "env": {"FOO": "bar baz", "BAZ": "1=2"}}`); w.Code != http.StatusCreated {
+		t.Fatalf("POST got %d: %s", w.Code, w.Body)
+	}
+	agents := agentPool.ListAll()
+	if len(agents) != 1 {
+		t.Fatalf("got %d agents, want 1", len(agents))
+	}
+	agent, err := agentPool.Get(agents[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(agent.Env, []string{"BAZ=1=2", "FOO=bar baz"}) || !slices.Equal(agent.Args, []string{"-u"}) {
+		t.Fatalf("agent args = %q, env = %q", agent.Args, agent.Env)
+	}
+}
@@ -0,0 +1,476 @@
+package webterm
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultSessionTTL is how long a login lasts.
+const DefaultSessionTTL = 12 * time.Hour
+
+const (
+	sessionCookie = "ac2_session"
+	// tokenParam carries a one-time access token, e.g. from the startup box.
+	tokenParam = "token"
+
+	passwordHashScheme     = "pbkdf2-sha256"
+	passwordHashIterations = 600_000
+
+	// loginFailureLimit failed logins from one address or for one user
+	// block further attempts from it or for them for loginLockout.
+	loginFailureLimit = 5
+	loginLockout      = time.Minute
+	// basicAuthCacheTTL is how long checked Basic Auth credentials are
+	// remembered, so scripts do not pay for a password hash per request.
+	basicAuthCacheTTL = 5 * time.Minute
+)
+
+var (
+	errInvalidLogin   = errors.New("invalid username or password")
+	errLoginThrottled = errors.New("too many failed logins, try again later")
+)
+
+// Account is a web terminal login. Hash is a password hash from
+// HashPassword; without one, Password is compared as-is.
+type Account struct {
+	User     string
+	Role     Role
+	Hash     string
+	Password string
+}
+
+func (a Account) check(password string) bool {
+	if a.Hash != "" {
+		return checkPasswordHash(a.Hash, password)
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(a.Password)) == 1
+}
+
+// authState holds the accounts, sessions and access tokens of a server.
+type authState struct {
+	mu       sync.Mutex
+	enabled  bool
+	accounts map[string]Account
+	secret   []byte
+	ttl      time.Duration
+	// tokens are unused one-time access tokens and their expiry.
+	tokens map[string]time.Time
+	// revoked holds logged-out session IDs until the sessions expire.
+	revoked map[string]time.Time
+
+	// failures counts recent failed logins per "ip:" and "user:" key.
+	failures map[string]*loginFailures
+	// basicCache maps signed Basic Auth credentials to their account.
+	basicCache map[string]cachedLogin
+	// dummyHash is checked for unknown users when any account has a hash,
+	// so that a login takes as long whether the user exists or not.
+	dummyHash string
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+}
+
+type cachedLogin struct {
+	role   Role
+	expiry time.Time
+}
+
+func newAuthState() *authState {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return &authState{
+		accounts: make(map[string]Account),
+		secret:   secret,
+		ttl:      DefaultSessionTTL,
+		tokens:   make(map[string]time.Time),
+		revoked:  make(map[string]time.Time),
+
+		failures:   make(map[string]*loginFailures),
+		basicCache: make(map[string]cachedLogin),
+	}
+}
+
+// HashPassword returns a salted PBKDF2 hash of password for an accounts
+// file.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+func checkPasswordHash(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, saltErr := enc.DecodeString(parts[2])
+	want, keyErr := enc.DecodeString(parts[3])
+	if saltErr != nil || keyErr != nil || len(want) == 0 {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && hmac.Equal(key, want)
+}
+
+// LoadAccounts parses accounts file lines of the form "user:hash" or
+// "user:hash:role", as printed by `ac2 web-passwd`. Blank lines and lines
+// starting with # are ignored.
+func LoadAccounts(data string) ([]Account, error) {
+	var accounts []Account
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash[:role]", i+1)
+		}
+		if !strings.HasPrefix(fields[1], passwordHashScheme+"$") {
+			return nil, fmt.Errorf("line %d: password of %s is not a %s hash", i+1, fields[0], passwordHashScheme)
+		}
+		role := RoleOperator
+		if len(fields) == 3 {
+			role = Role(fields[2])
+			if role != RoleOperator && role != RoleViewer {
+				return nil, fmt.Errorf("line %d: unknown role %q", i+1, fields[2])
+			}
+		}
+		accounts = append(accounts, Account{User: fields[0], Role: role, Hash: fields[1]})
+	}
+	return accounts, nil
+}
+
+// AddAccounts lets accounts log in and turns on authentication.
+func (s *Server) AddAccounts(accounts ...Account) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	for _, account := range accounts {
+		s.auth.accounts[account.User] = account
+		s.auth.enabled = true
+		if account.Hash != "" && s.auth.dummyHash == "" {
+			s.auth.dummyHash, _ = HashPassword(randomToken())
+		}
+	}
+	clear(s.auth.basicCache)
+}
+
+// SetSessionTTL changes how long logins last.
+func (s *Server) SetSessionTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	s.auth.ttl = ttl
+}
+
+// NewAccessToken returns a one-time operator token for a login link
+// (/?token=<token>) and turns on authentication.
+func (s *Server) NewAccessToken() string {
+	token := randomToken()
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	s.auth.tokens[token] = time.Now().Add(s.auth.ttl)
+	s.auth.enabled = true
+	return token
+}
+
+func (s *Server) authEnabled() bool {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	return s.auth.enabled
+}
+
+// redeemLink checks the access or share token in the query of a login
+// link. Access tokens work only once.
+func (s *Server) redeemLink(r *http.Request) (Role, bool) {
+	query := r.URL.Query()
+	if token := query.Get(tokenParam); token != "" {
+		s.auth.mu.Lock()
+		defer s.auth.mu.Unlock()
+		expiry, ok := s.auth.tokens[token]
+		delete(s.auth.tokens, token)
+		return RoleOperator, ok && time.Now().Before(expiry)
+	}
+	if token := query.Get(shareParam); token != "" && s.shareToken != "" {
+		return RoleViewer, subtle.ConstantTimeCompare([]byte(token), []byte(s.shareToken)) == 1
+	}
+	return "", false
+}
+
+// authenticate returns the role of a request with a session cookie or
+// Basic Auth credentials, which scripts may still use.
+func (s *Server) authenticate(r *http.Request) (Role, bool) {
+	if _, role, ok := s.session(r); ok {
+		return role, true
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		return s.basicLogin(clientAddr(r.RemoteAddr), user, pass)
+	}
+	return "", false
+}
+
+// basicLogin checks Basic Auth credentials, which scripts send with every
+// request, remembering them for a while once they have been checked.
+func (s *Server) basicLogin(addr, user, pass string) (Role, bool) {
+	key := s.sign(user + "\x00" + pass)
+	s.auth.mu.Lock()
+	cached, ok := s.auth.basicCache[key]
+	s.auth.mu.Unlock()
+	if ok && time.Now().Before(cached.expiry) {
+		return cached.role, true
+	}
+
+	role, err := s.login(addr, user, pass)
+	if err != nil {
+		return "", false
+	}
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	now := time.Now()
+	for cachedKey, entry := range s.auth.basicCache {
+		if now.After(entry.expiry) {
+			delete(s.auth.basicCache, cachedKey)
+		}
+	}
+	s.auth.basicCache[key] = cachedLogin{role: role, expiry: now.Add(basicAuthCacheTTL)}
+	return role, true
+}
+
+// login checks a password unless addr or user failed too often recently.
+func (s *Server) login(addr, user, pass string) (Role, error) {
+	keys := []string{"ip:" + addr, "user:" + user}
+	s.auth.mu.Lock()
+	account, ok := s.auth.accounts[user]
+	dummyHash := s.auth.dummyHash
+	throttled := s.auth.throttled(keys)
+	s.auth.mu.Unlock()
+	if throttled {
+		return "", errLoginThrottled
+	}
+
+	if !ok {
+		if dummyHash != "" {
+			checkPasswordHash(dummyHash, pass)
+		}
+	} else if account.check(pass) {
+		return account.Role, nil
+	}
+
+	s.auth.mu.Lock()
+	s.auth.recordFailure(keys)
+	s.auth.mu.Unlock()
+	logger.Printf("WebTerm: failed login for %q from %s", user, addr)
+	return "", errInvalidLogin
+}
+
+// throttled reports whether any of keys has reached the failure limit
+// within the lockout. Callers must hold a.mu.
+func (a *authState) throttled(keys []string) bool {
+	for _, key := range keys {
+		f, ok := a.failures[key]
+		if ok && f.count >= loginFailureLimit && time.Since(f.last) < loginLockout {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFailure counts a failed login for keys. Callers must hold a.mu.
+func (a *authState) recordFailure(keys []string) {
+	now := time.Now()
+	for key, f := range a.failures {
+		if now.Sub(f.last) >= loginLockout {
+			delete(a.failures, key)
+		}
+	}
+	for _, key := range keys {
+		f, ok := a.failures[key]
+		if !ok {
+			f = &loginFailures{}
+			a.failures[key] = f
+		}
+		f.count++
+		f.last = now
+	}
+}
+
+// issueSession sets a signed session cookie for role.
+func (s *Server) issueSession(w http.ResponseWriter, r *http.Request, user string, role Role) {
+	s.auth.mu.Lock()
+	expiry := time.Now().Add(s.auth.ttl)
+	s.auth.mu.Unlock()
+
+	payload := strings.Join([]string{randomToken(), string(role), strconv.FormatInt(expiry.Unix(), 10), user}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    encoded + "." + s.sign(encoded),
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// session verifies the session cookie of r.
+func (s *Server) session(r *http.Request) (id string, role Role, ok bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", "", false
+	}
+	encoded, sig, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(sig), []byte(s.sign(encoded))) {
+		return "", "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	fields := strings.SplitN(string(payload), "|", 4)
+	if len(fields) != 4 {
+		return "", "", false
+	}
+	expiry, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() >= expiry {
+		return "", "", false
+	}
+
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+	if _, revoked := s.auth.revoked[fields[0]]; revoked {
+		return "", "", false
+	}
+	return fields[0], Role(fields[1]), true
+}
+
+func (s *Server) sign(value string) string {
+	mac := hmac.New(sha256.New, s.auth.secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.FormValue("next"))
+	if r.Method == http.MethodPost {
+		user := r.PostFormValue("user")
+		role, err := s.login(clientAddr(r.RemoteAddr), user, r.PostFormValue("password"))
+		switch {
+		case err == nil:
+			s.issueSession(w, r, user, role)
+			http.Redirect(w, r, next, http.StatusSeeOther)
+		case errors.Is(err, errLoginThrottled):
+			renderLogin(w, r, http.StatusTooManyRequests, next, "Too many failed logins, try again later")
+		default:
+			renderLogin(w, r, http.StatusUnauthorized, next, "Invalid username or password")
+		}
+		return
+	}
+	if _, _, ok := s.session(r); ok {
+		http.Redirect(w, r, next, http.StatusFound)
+		return
+	}
+	renderLogin(w, r, http.StatusOK, next, "")
+}
+
+// handleLogout ends the session. It only accepts POST, so other sites
+// cannot log users out with a link.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id, _, ok := s.session(r); ok {
+		s.auth.mu.Lock()
+		now := time.Now()
+		for revokedID, expiry := range s.auth.revoked {
+			if now.After(expiry) {
+				delete(s.auth.revoked, revokedID)
+			}
+		}
+		s.auth.revoked[id] = now.Add(s.auth.ttl)
+		s.auth.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func renderLogin(w http.ResponseWriter, r *http.Request, status int, next, message string) {
+	page := strings.ReplaceAll(loginHTMLTemplate, "{{NEXT}}", html.EscapeString(next))
+	page = strings.ReplaceAll(page, "{{CSRF_TOKEN}}", csrfToken(w, r))
+	page = strings.ReplaceAll(page, "{{MESSAGE}}", html.EscapeString(message))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(page))
+}
+
+// unauthorized sends browsers to the login page and answers everything
+// else with 401.
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	page := r.URL.Path != "/health" && !strings.HasPrefix(r.URL.Path, "/api/")
+	if r.Method == http.MethodGet && page && !websocket.IsWebSocketUpgrade(r) {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(withoutParams(r.URL, tokenParam)), http.StatusFound)
+		return
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// safeNext keeps post-login redirects on this server.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// withoutParams returns the request URI of u without the given query
+// parameters.
+func withoutParams(u *url.URL, names ...string) string {
+	stripped := *u
+	query := stripped.Query()
+	for _, name := range names {
+		query.Del(name)
+	}
+	stripped.RawQuery = query.Encode()
+	return stripped.RequestURI()
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package webterm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func newAuthTestServer() *Server {
+	s := NewServer(0, "", "", "test")
+	s.AddAccounts(Account{User: "alice", Role: RoleOperator, Password: "secret"})
+	return s
+}
+
+func TestLoginThrottling(t *testing.T) {
+	tests := []struct {
+		name string
+		// attempt returns the address and user of the i-th failed login.
+		attempt func(i int) (addr, user string)
+		// addr and user of the valid login that follows.
+		addr, user string
+	}{
+		{
+			name:    "per address",
+			attempt: func(i int) (string, string) { return "10.0.0.1", fmt.Sprintf("user%d", i) },
+			addr:    "10.0.0.1",
+			user:    "alice",
+		},
+		{
+			name:    "per user",
+			attempt: func(i int) (string, string) { return fmt.Sprintf("10.0.0.%d", i+2), "alice" },
+			addr:    "10.0.1.1",
+			user:    "alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAuthTestServer()
+			for i := range loginFailureLimit {
+				addr, user := tt.attempt(i)
+				if _, err := s.login(addr, user, "wrong"); !errors.Is(err, errInvalidLogin) {
+					t.Fatalf("attempt %d: got %v, want errInvalidLogin", i, err)
+				}
+			}
+			if _, err := s.login(tt.addr, tt.user, "secret"); !errors.Is(err, errLoginThrottled) {
+				t.Fatalf("got %v, want errLoginThrottled", err)
+			}
+			// Others are not affected
+			if _, err := s.login("192.168.0.1", "bob", "secret"); !errors.Is(err, errInvalidLogin) {
+				t.Fatalf("unrelated login got %v, want errInvalidLogin", err)
+			}
+		})
+	}
+}
+
+func TestBasicLoginCache(t *testing.T) {
+	s := newAuthTestServer()
+	if role, ok := s.basicLogin("10.0.0.1", "alice", "secret"); !ok || role != RoleOperator {
+		t.Fatalf("got %q, %v", role, ok)
+	}
+	if len(s.auth.basicCache) != 1 {
+		t.Fatalf("cache holds %d entries, want 1", len(s.auth.basicCache))
+	}
+	if _, ok := s.basicLogin("10.0.0.1", "alice", "wrong"); ok {
+		t.Fatal("wrong password accepted")
+	}
+
+	// Changing accounts drops remembered credentials
+	s.AddAccounts(Account{User: "alice", Role: RoleViewer, Password: "secret"})
+	if role, ok := s.basicLogin("10.0.0.1", "alice", "secret"); !ok || role != RoleViewer {
+		t.Fatalf("got %q, %v after the account changed", role, ok)
+	}
+}
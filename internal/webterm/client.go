@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
 	"github.com/gorilla/websocket"
 )
 
@@ -18,6 +19,32 @@ const (
 	MsgTypeAgent  MessageType = "agent"
 	MsgTypeReset  MessageType = "reset"
 	MsgTypeClose  MessageType = "disconnect"
+	// MsgTypeNotice carries a one-line status notice, e.g. about an agent
+	// restart.
+	MsgTypeNotice MessageType = "notice"
+	// MsgTypeRole tells the client its Role when it connects.
+	MsgTypeRole MessageType = "role"
+
+	// Replay messages: the server reports playback state with
+	// MsgTypeReplay, the client controls it with the others.
+	MsgTypeReplay MessageType = "replay"
+	MsgTypePlay   MessageType = "play"
+	MsgTypePause  MessageType = "pause"
+	MsgTypeSeek   MessageType = "seek"
+	MsgTypeSpeed  MessageType = "speed"
+
+	// Control messages from operators, see control.go. Switch and restart
+	// take an agent ID in Data, disconnect-client a client ID. The server
+	// answers list-clients with MsgTypeClients and reports other outcomes
+	// with MsgTypeNotice.
+	MsgTypeSwitch           MessageType = "switch"
+	MsgTypeRestart          MessageType = "restart"
+	MsgTypeListClients      MessageType = "list-clients"
+	MsgTypeDisconnectClient MessageType = "disconnect-client"
+	MsgTypeQuit             MessageType = "quit"
+	// MsgTypeClients lists the connected clients; Data is the receiving
+	// client's ID.
+	MsgTypeClients MessageType = "clients"
 )
 
 type Message struct {
@@ -25,6 +52,15 @@ type Message struct {
 	Data string      `json:"data,omitempty"`
 	Rows uint16      `json:"rows,omitempty"`
 	Cols uint16      `json:"cols,omitempty"`
+
+	// Replay state and controls
+	Time     float64 `json:"time,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+	Paused   bool    `json:"paused,omitempty"`
+	Ended    bool    `json:"ended,omitempty"`
+
+	Clients []ClientInfo `json:"clients,omitempty"`
 }
 
 type Client struct {
@@ -36,9 +72,21 @@ type Client struct {
 	closeOnce sync.Once
 	addr      string
 	userAgent string
+	role      Role
+
+	// agentID and proxy are set when the client is pinned to a specific
+	// instance instead of following the server's current agent.
+	agentID string
+	proxy   *ptyproxy.Proxy
+	proxyMu sync.RWMutex
+
+	// cols and rows are the browser's terminal size.
+	cols   uint16
+	rows   uint16
+	sizeMu sync.Mutex
 }
 
-func NewClient(id string, conn *websocket.Conn, server *Server, addr string, userAgent string) *Client {
+func NewClient(id string, conn *websocket.Conn, server *Server, addr string, userAgent string, role Role) *Client {
 	c := &Client{
 		id:        id,
 		conn:      conn,
@@ -47,6 +95,7 @@ func NewClient(id string, conn *websocket.Conn, server *Server, addr string, use
 		closeCh:   make(chan struct{}),
 		addr:      addr,
 		userAgent: userAgent,
+		role:      role,
 	}
 
 	go c.readLoop()
@@ -65,26 +114,41 @@ func (c *Client) readLoop() {
 			return
 		}
 
+		// Viewers only watch; their input and size do not reach the agent
+		if c.role == RoleViewer && (msg.Type == MsgTypeData || msg.Type == MsgTypeResize) {
+			continue
+		}
+
 		switch msg.Type {
 		case MsgTypeData:
 			// Mark web as active when receiving input
 			c.server.setActiveSource("web")
+			c.server.setSizeOwner(c.id)
 
 			data, err := base64.StdEncoding.DecodeString(msg.Data)
 			if err != nil {
 				continue
 			}
-			if c.server.proxy != nil {
-				_, _ = c.server.proxy.Write(data)
+			if proxy := c.targetProxy(); proxy != nil {
+				_, _ = proxy.Write(data)
 			}
 
 		case MsgTypeResize:
-			// if c.server.proxy != nil {
-			// 	_ = c.server.proxy.Resize(msg.Rows, msg.Cols)
-			// }
+			if msg.Cols == 0 || msg.Rows == 0 {
+				continue
+			}
+			c.sizeMu.Lock()
+			c.cols, c.rows = msg.Cols, msg.Rows
+			c.sizeMu.Unlock()
+			c.server.scheduleResize()
 
 		case MsgTypePing:
 			_ = c.conn.WriteJSON(Message{Type: MsgTypePong})
+
+		default:
+			if isControlMessage(msg) {
+				c.server.handleControl(c, msg)
+			}
 		}
 	}
 }
@@ -141,6 +205,10 @@ func (c *Client) SendDisconnect(reason string) {
 	c.SendMessage(msg)
 }
 
+func (c *Client) SendNotice(text string) {
+	c.SendMessage(Message{Type: MsgTypeNotice, Data: text})
+}
+
 func (c *Client) SendMessage(msg Message) {
 	select {
 	case c.sendCh <- msg:
@@ -150,8 +218,56 @@ func (c *Client) SendMessage(msg Message) {
 	}
 }
 
+// attach pins the client to an instance's proxy, starting with its recent
+// output.
+func (c *Client) attach(agentID string, proxy *ptyproxy.Proxy) {
+	c.proxyMu.Lock()
+	c.agentID = agentID
+	c.proxy = proxy
+	c.proxyMu.Unlock()
+	proxy.AddOutputHandlerWithHistory(c.handlerID(), c.Send)
+}
+
+// detach removes the output handler of a pinned client.
+func (c *Client) detach() {
+	c.proxyMu.Lock()
+	proxy := c.proxy
+	c.proxy = nil
+	c.proxyMu.Unlock()
+	if proxy != nil {
+		proxy.RemoveOutputHandler(c.handlerID())
+	}
+}
+
+func (c *Client) pinned() bool {
+	c.proxyMu.RLock()
+	defer c.proxyMu.RUnlock()
+	return c.agentID != ""
+}
+
+// targetProxy returns the proxy that receives this client's input.
+func (c *Client) targetProxy() *ptyproxy.Proxy {
+	c.proxyMu.RLock()
+	defer c.proxyMu.RUnlock()
+	if c.agentID != "" {
+		return c.proxy
+	}
+	return c.server.currentProxy()
+}
+
+func (c *Client) size() (cols, rows uint16) {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	return c.cols, c.rows
+}
+
+func (c *Client) handlerID() string {
+	return c.server.handlerID + "-" + c.id
+}
+
 func (c *Client) Close() {
 	c.closeOnce.Do(func() {
+		c.detach()
 		close(c.closeCh)
 		_ = c.conn.Close()
 		c.server.removeClient(c.id)
@@ -165,6 +281,7 @@ func (c *Client) CloseWithReason(code int, reason string) {
 			websocket.FormatCloseMessage(code, reason),
 			time.Now().Add(1*time.Second),
 		)
+		c.detach()
 		close(c.closeCh)
 		_ = c.conn.Close()
 		c.server.removeClient(c.id)
@@ -172,9 +289,13 @@ func (c *Client) CloseWithReason(code int, reason string) {
 }
 
 func (c *Client) Info() ClientInfo {
+	c.proxyMu.RLock()
+	defer c.proxyMu.RUnlock()
 	return ClientInfo{
 		ID:        c.id,
 		Addr:      c.addr,
 		UserAgent: c.userAgent,
+		AgentID:   c.agentID,
+		Role:      c.role,
 	}
 }
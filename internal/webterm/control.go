@@ -0,0 +1,87 @@
+package webterm
+
+import (
+	"fmt"
+
+	"github.com/biliqiqi/ac2/internal/control"
+	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+// SetController lets operators switch and restart agents, manage clients
+// and quit ac2 from the browser. Clients that follow the current agent
+// move along when the controller attaches another one.
+func (s *Server) SetController(controller *control.Controller) {
+	s.controller = controller
+	controller.OnAttach(func(agent *pool.AgentInstance) {
+		s.SetProxy(agent.Proxy())
+		s.SetAgentName(agent.DisplayName())
+		s.BroadcastReset()
+	})
+}
+
+// isControlMessage reports whether msg asks for a control action.
+func isControlMessage(msg Message) bool {
+	switch msg.Type {
+	case MsgTypeSwitch, MsgTypeRestart, MsgTypeListClients, MsgTypeDisconnectClient, MsgTypeQuit:
+		return true
+	}
+	return false
+}
+
+// handleControl carries out a control message from client and reports the
+// outcome to it.
+func (s *Server) handleControl(client *Client, msg Message) {
+	if client.role != RoleOperator {
+		client.SendNotice("viewers cannot control agents")
+		return
+	}
+	if msg.Type != MsgTypeListClients {
+		logger.Printf("WebTerm: %s %q from %s", msg.Type, msg.Data, client.addr)
+	}
+	if err := s.runControl(client, msg); err != nil {
+		client.SendNotice(fmt.Sprintf("%s failed: %v", msg.Type, err))
+	}
+}
+
+func (s *Server) runControl(client *Client, msg Message) error {
+	switch msg.Type {
+	case MsgTypeListClients:
+		client.SendMessage(Message{Type: MsgTypeClients, Data: client.id, Clients: s.ListClients()})
+		return nil
+	case MsgTypeDisconnectClient:
+		if msg.Data == client.id {
+			return fmt.Errorf("cannot disconnect this client")
+		}
+		if err := s.DisconnectClient(msg.Data); err != nil {
+			return err
+		}
+		client.SendMessage(Message{Type: MsgTypeClients, Data: client.id, Clients: s.ListClients()})
+		return nil
+	}
+
+	if s.controller == nil {
+		return fmt.Errorf("agent control is not available")
+	}
+	switch msg.Type {
+	case MsgTypeSwitch:
+		agent, err := s.controller.Switch(msg.Data)
+		if err != nil {
+			return err
+		}
+		client.SendNotice("switched to " + agent.DisplayName())
+	case MsgTypeRestart:
+		id := msg.Data
+		if id == "" {
+			id = s.controller.Current().ID
+		}
+		agent, err := s.controller.Restart(id)
+		if err != nil {
+			return err
+		}
+		client.SendNotice(fmt.Sprintf("restarted %s as %s", id, agent.ID))
+	case MsgTypeQuit:
+		s.controller.Quit()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package webterm
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	csrfCookie = "ac2_csrf"
+	// csrfParam carries the CSRF token in WebSocket URLs and forms.
+	csrfParam = "csrf"
+	// csrfHeader carries the CSRF token in scripted requests.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// ParseOrigins validates scheme://host[:port] origins for
+// SetAllowedOrigins.
+func ParseOrigins(origins []string) ([]string, error) {
+	parsed := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		normalized, err := normalizeOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, normalized)
+	}
+	return parsed, nil
+}
+
+// SetAllowedOrigins lets pages from other origins, e.g. a reverse proxy
+// address, open the web terminal.
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.allowedOrigins = origins
+}
+
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// originAllowed reports whether a browser request may come from origin: the
+// page must be served by this host or by an allowed origin.
+func (s *Server) originAllowed(origin string, r *http.Request) bool {
+	normalized, err := normalizeOrigin(origin)
+	if err != nil {
+		return false
+	}
+	u, _ := url.Parse(normalized)
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return slices.Contains(s.allowedOrigins, normalized)
+}
+
+// checkRequest guards against cross-site requests. Browsers send Origin
+// with WebSocket handshakes and POSTs, so such requests must come from an
+// allowed page and carry the CSRF token it was given. Clients without
+// Origin, such as scripts, are not subject to cross-site requests.
+func (s *Server) checkRequest(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if !s.originAllowed(origin, r) {
+		return fmt.Errorf("origin %s is not allowed", origin)
+	}
+	if (r.Method == http.MethodGet && !websocket.IsWebSocketUpgrade(r)) || r.Method == http.MethodHead {
+		return nil
+	}
+
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return fmt.Errorf("missing CSRF cookie")
+	}
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.URL.Query().Get(csrfParam)
+	}
+	if token == "" && r.Method == http.MethodPost {
+		token = r.PostFormValue(csrfParam)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+		return fmt.Errorf("invalid CSRF token")
+	}
+	return nil
+}
+
+// csrfToken returns the CSRF token for a page, setting the cookie it is
+// checked against on first use.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) == 32 {
+		return cookie.Value
+	}
+	token := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
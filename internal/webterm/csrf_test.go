@@ -0,0 +1,124 @@
+package webterm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testCSRFToken = "0123456789abcdef0123456789abcdef"
+
+func TestCheckRequest(t *testing.T) {
+	s := NewServer(0, "", "", "test")
+	s.SetAllowedOrigins([]string{"https://proxy.example"})
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		origin  string
+		cookie  bool
+		header  string
+		form    string
+		upgrade bool
+		wantErr bool
+	}{
+		{name: "no origin", method: http.MethodPost, target: "/api/agents"},
+		{name: "same origin page", method: http.MethodGet, target: "/", origin: "http://ac2.local:8080"},
+		{name: "foreign origin page", method: http.MethodGet, target: "/", origin: "https://evil.example", wantErr: true},
+		{name: "foreign origin post", method: http.MethodPost, target: "/api/agents", origin: "https://evil.example", cookie: true, header: testCSRFToken, wantErr: true},
+		{name: "invalid origin", method: http.MethodGet, target: "/", origin: "null", wantErr: true},
+		{name: "allowed origin", method: http.MethodPost, target: "/api/agents", origin: "https://PROXY.example", cookie: true, header: testCSRFToken},
+		{name: "post without cookie", method: http.MethodPost, target: "/api/agents", origin: "http://ac2.local:8080", header: testCSRFToken, wantErr: true},
+		{name: "post without token", method: http.MethodPost, target: "/api/agents", origin: "http://ac2.local:8080", cookie: true, wantErr: true},
+		{name: "post with wrong token", method: http.MethodPost, target: "/api/agents", origin: "http://ac2.local:8080", cookie: true, header: strings.Repeat("x", 32), wantErr: true},
+		{name: "post with header token", method: http.MethodPost, target: "/api/agents", origin: "http://ac2.local:8080", cookie: true, header: testCSRFToken},
+		{name: "post with form token", method: http.MethodPost, target: "/logout", origin: "http://ac2.local:8080", cookie: true, form: testCSRFToken},
+		{name: "delete without token", method: http.MethodDelete, target: "/api/agents/x", origin: "http://ac2.local:8080", cookie: true, wantErr: true},
+		{name: "websocket without token", method: http.MethodGet, target: "/ws", origin: "http://ac2.local:8080", cookie: true, upgrade: true, wantErr: true},
+		{name: "websocket with query token", method: http.MethodGet, target: "/ws?csrf=" + testCSRFToken, origin: "http://ac2.local:8080", cookie: true, upgrade: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.form != "" {
+				body = url.Values{csrfParam: {tt.form}}.Encode()
+			}
+			r := httptest.NewRequest(tt.method, "http://ac2.local:8080"+tt.target, strings.NewReader(body))
+			if tt.form != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.cookie {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+			if tt.upgrade {
+				r.Header.Set("Connection", "Upgrade")
+				r.Header.Set("Upgrade", "websocket")
+			}
+
+			err := s.checkRequest(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkRequest() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCrossSiteRequestForbidden(t *testing.T) {
+	s := NewServer(0, "", "", "test")
+	handler := s.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "http://ac2.local:8080/api/agents", strings.NewReader("{}"))
+	r.Header.Set("Origin", "https://evil.example")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("cross-site POST got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	got, err := ParseOrigins([]string{"https://Proxy.Example", " http://localhost:8080/ "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://proxy.example", "http://localhost:8080"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("ParseOrigins() = %v, want %v", got, want)
+	}
+
+	for _, origin := range []string{"proxy.example", "https://proxy.example/path", "://x"} {
+		if _, err := ParseOrigins([]string{origin}); err == nil {
+			t.Errorf("ParseOrigins(%q) accepted an invalid origin", origin)
+		}
+	}
+}
+
+func TestCSRFTokenReusesCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	token := csrfToken(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie || cookies[0].Value != token {
+		t.Fatalf("new token %q not set as cookie: %v", token, cookies)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	if got := csrfToken(w, r); got != token {
+		t.Fatalf("token changed from %q to %q", token, got)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("existing token was set again")
+	}
+}
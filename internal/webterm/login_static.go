@@ -0,0 +1,80 @@
+package webterm
+
+const loginHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>ac2 Login</title>
+    <style>
+        body {
+            margin: 0;
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            background: #f5f2ec;
+            color: #1f1d1a;
+            font-family: "IBM Plex Sans", "Trebuchet MS", "Segoe UI", sans-serif;
+        }
+        form {
+            width: 300px;
+            padding: 24px;
+            background: #fffdf9;
+            border: 1px solid #e0d8cc;
+            border-radius: 8px;
+            box-shadow: 0 16px 40px rgba(36, 32, 25, 0.12);
+        }
+        h1 {
+            font-size: 18px;
+            margin: 0 0 16px;
+        }
+        label {
+            display: block;
+            font-size: 13px;
+            color: #6a635b;
+            margin-bottom: 12px;
+        }
+        input {
+            display: block;
+            width: 100%;
+            box-sizing: border-box;
+            margin-top: 4px;
+            padding: 8px;
+            font-size: 14px;
+            border: 1px solid #d8cfc2;
+            border-radius: 4px;
+        }
+        button {
+            width: 100%;
+            padding: 8px;
+            font-size: 14px;
+            background: #f3eee7;
+            color: #2b2520;
+            border: 1px solid #d8cfc2;
+            border-radius: 4px;
+            cursor: pointer;
+        }
+        .message {
+            color: #b3261e;
+            font-size: 13px;
+            margin: 0 0 12px;
+        }
+        .message:empty {
+            display: none;
+        }
+    </style>
+</head>
+<body>
+    <form method="post" action="/login">
+        <h1>ac2 Web Terminal</h1>
+        <p class="message">{{MESSAGE}}</p>
+        <input type="hidden" name="next" value="{{NEXT}}">
+        <input type="hidden" name="csrf" value="{{CSRF_TOKEN}}">
+        <label>Username <input name="user" autocomplete="username" autofocus></label>
+        <label>Password <input name="password" type="password" autocomplete="current-password"></label>
+        <button type="submit">Log in</button>
+    </form>
+</body>
+</html>
+`
@@ -0,0 +1,208 @@
+package webterm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/asciicast"
+	"github.com/biliqiqi/ac2/internal/logger"
+)
+
+// replayIdleLimit caps pauses between events when replaying in the browser.
+const replayIdleLimit = 2.0
+
+// SetRecordDir enables /replay for the asciicast recordings in dir.
+func (s *Server) SetRecordDir(dir string) {
+	s.recordDir = dir
+}
+
+// recordingPath resolves a recording name from a request to a file inside
+// the record directory, rejecting anything that could escape it.
+func (s *Server) recordingPath(name string) (string, error) {
+	if s.recordDir == "" {
+		return "", fmt.Errorf("recording is not enabled (start ac2 with --record-dir)")
+	}
+	if name == "" || name != filepath.Base(name) || !strings.HasSuffix(name, ".cast") {
+		return "", fmt.Errorf("invalid recording name")
+	}
+	path := filepath.Join(s.recordDir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("recording not found")
+	}
+	return path, nil
+}
+
+// canReplay rejects viewers. Recordings hold typed input, including
+// secrets, and sessions of every agent, not only what viewers may watch.
+func (s *Server) canReplay(w http.ResponseWriter, r *http.Request) bool {
+	if requestRole(r) != RoleOperator {
+		http.Error(w, "viewers cannot watch recordings", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if !s.canReplay(w, r) {
+		return
+	}
+	if s.recordDir == "" {
+		http.Error(w, "recording is not enabled (start ac2 with --record-dir)", http.StatusNotFound)
+		return
+	}
+
+	name := r.URL.Query().Get("file")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if name == "" {
+		_, _ = w.Write([]byte(s.renderRecordingList()))
+		return
+	}
+	if _, err := s.recordingPath(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(renderReplayHTML(name, csrfToken(w, r))))
+}
+
+func (s *Server) renderRecordingList() string {
+	entries, err := os.ReadDir(s.recordDir)
+	if err != nil {
+		return strings.ReplaceAll(recordingListHTMLTemplate, "{{ITEMS}}",
+			"<li class=\"empty\">"+html.EscapeString(err.Error())+"</li>")
+	}
+
+	type recording struct {
+		name string
+		info os.FileInfo
+	}
+	var recordings []recording
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".cast") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, recording{entry.Name(), info})
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].info.ModTime().After(recordings[j].info.ModTime())
+	})
+
+	var items strings.Builder
+	for _, rec := range recordings {
+		fmt.Fprintf(&items, "<li><a href=\"/replay?file=%s\">%s</a><span>%s · %d KB</span></li>\n",
+			url.QueryEscape(rec.name), html.EscapeString(rec.name),
+			rec.info.ModTime().Format("2006-01-02 15:04:05"), (rec.info.Size()+1023)/1024)
+	}
+	if len(recordings) == 0 {
+		items.WriteString("<li class=\"empty\">No recordings yet</li>")
+	}
+	return strings.ReplaceAll(recordingListHTMLTemplate, "{{ITEMS}}", items.String())
+}
+
+// handleReplayWebSocket streams a recording to an xterm.js client using the
+// regular Message protocol, driven by play/pause/seek/speed messages.
+func (s *Server) handleReplayWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.canReplay(w, r) {
+		return
+	}
+	path, err := s.recordingPath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	cast, err := asciicast.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	var writeMu sync.Mutex
+	send := func(msg Message) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		_ = conn.WriteJSON(msg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	player := asciicast.NewPlayer(cast, asciicast.PlayerOptions{
+		IdleLimit: replayIdleLimit,
+		HoldAtEnd: true,
+	})
+
+	go func() {
+		defer cancel()
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case MsgTypePlay:
+				player.SetPaused(false)
+			case MsgTypePause:
+				player.SetPaused(true)
+			case MsgTypeSeek:
+				player.Seek(msg.Time)
+			case MsgTypeSpeed:
+				player.SetSpeed(msg.Speed)
+			case MsgTypePing:
+				send(Message{Type: MsgTypePong})
+			}
+		}
+	}()
+
+	logger.Printf("WebServer: replaying %s", filepath.Base(path))
+	_ = player.Run(ctx, asciicast.PlayerHandlers{
+		OnEvent: func(event asciicast.Event) {
+			switch event.Code {
+			case asciicast.EventOutput:
+				send(Message{Type: MsgTypeData, Data: base64.StdEncoding.EncodeToString([]byte(event.Data))})
+			case asciicast.EventResize:
+				if cols, rows, ok := asciicast.ParseSize(event.Data); ok {
+					send(Message{Type: MsgTypeResize, Cols: uint16(cols), Rows: uint16(rows)})
+				}
+			}
+		},
+		OnSeek: func() {
+			send(Message{Type: MsgTypeReset})
+		},
+		OnState: func(state asciicast.PlayerState) {
+			send(Message{
+				Type:     MsgTypeReplay,
+				Time:     state.Position,
+				Duration: state.Duration,
+				Speed:    state.Speed,
+				Paused:   state.Paused,
+				Ended:    state.Ended,
+			})
+		},
+	})
+}
+
+func renderReplayHTML(name, csrf string) string {
+	page := strings.ReplaceAll(replayHTMLTemplate, "{{FILE_NAME}}", html.EscapeString(name))
+	page = strings.ReplaceAll(page, "{{CSRF_TOKEN}}", csrf)
+	return strings.ReplaceAll(page, "{{FILE_QUERY}}", url.QueryEscape(name))
+}
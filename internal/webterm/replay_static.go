@@ -0,0 +1,254 @@
+package webterm
+
+const recordingListHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>ac2 Recordings</title>
+    <style>
+        body {
+            margin: 0;
+            padding: 24px;
+            background: #f5f2ec;
+            color: #1f1d1a;
+            font-family: "IBM Plex Sans", "Trebuchet MS", "Segoe UI", sans-serif;
+        }
+        h1 {
+            font-size: 18px;
+            margin: 0 0 16px;
+        }
+        ul {
+            list-style: none;
+            margin: 0;
+            padding: 0;
+            max-width: 720px;
+            background: #fffdf9;
+            border: 1px solid #e0d8cc;
+            border-radius: 8px;
+        }
+        li {
+            display: flex;
+            justify-content: space-between;
+            gap: 16px;
+            padding: 10px 16px;
+            border-bottom: 1px solid #e9e4db;
+            font-size: 14px;
+        }
+        li:last-child {
+            border-bottom: none;
+        }
+        li span, li.empty {
+            color: #6a635b;
+        }
+        a {
+            color: #7a5230;
+            font-family: "IBM Plex Mono", Menlo, Consolas, monospace;
+            text-decoration: none;
+        }
+        a:hover {
+            text-decoration: underline;
+        }
+    </style>
+</head>
+<body>
+    <h1>ac2 Recordings</h1>
+    <ul>
+{{ITEMS}}
+    </ul>
+</body>
+</html>
+`
+
+const replayHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>ac2 Replay - {{FILE_NAME}}</title>
+    <link rel="stylesheet" href="/static/xterm.css" />
+    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+        body {
+            background: #f5f2ec;
+            color: #1f1d1a;
+            font-family: "IBM Plex Sans", "Trebuchet MS", "Segoe UI", sans-serif;
+            display: flex;
+            flex-direction: column;
+            height: 100vh;
+            overflow: hidden;
+        }
+        #info-bar {
+            background: #fffdf9;
+            border-bottom: 1px solid #e0d8cc;
+            padding: 10px 20px;
+            font-size: 13px;
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+        }
+        #info-bar .title {
+            font-weight: 700;
+        }
+        #info-bar .file {
+            font-weight: 600;
+            color: #7a5230;
+        }
+        #info-bar a {
+            color: #6a635b;
+        }
+        #terminal-container {
+            flex: 1;
+            padding: 4px;
+            overflow: auto;
+            background: #1e1e1e;
+            min-height: 0;
+        }
+        #controls {
+            display: flex;
+            align-items: center;
+            gap: 10px;
+            padding: 8px 16px;
+            background: #fffdf9;
+            border-top: 1px solid #e0d8cc;
+            font-size: 13px;
+        }
+        #controls button, #controls select {
+            background: #f3eee7;
+            border: 1px solid #d8cfc2;
+            border-radius: 4px;
+            color: #2b2520;
+            padding: 4px 10px;
+            font-size: 13px;
+            cursor: pointer;
+        }
+        #seek {
+            flex: 1;
+        }
+        #time {
+            font-family: "IBM Plex Mono", Menlo, Consolas, monospace;
+            color: #6a635b;
+            min-width: 110px;
+            text-align: right;
+        }
+        #status.disconnected {
+            color: #b3261e;
+        }
+    </style>
+</head>
+<body>
+    <div id="info-bar">
+        <div><span class="title">ac2 Replay</span> &middot; <span class="file">{{FILE_NAME}}</span></div>
+        <div><span id="status">Connecting...</span> &middot; <a href="/replay">All recordings</a></div>
+    </div>
+    <div id="terminal-container"></div>
+    <div id="controls">
+        <button id="play" type="button">Pause</button>
+        <input id="seek" type="range" min="0" max="0" step="0.1" value="0" />
+        <span id="time">0:00 / 0:00</span>
+        <select id="speed">
+            <option value="0.5">0.5x</option>
+            <option value="1" selected>1x</option>
+            <option value="2">2x</option>
+            <option value="4">4x</option>
+            <option value="8">8x</option>
+        </select>
+    </div>
+    <script src="/static/xterm.js"></script>
+    <script>
+        const term = new Terminal({
+            cursorBlink: false,
+            disableStdin: true,
+            fontSize: 14,
+            fontFamily: 'Menlo, Monaco, "Courier New", monospace',
+            theme: { background: '#1e1e1e', foreground: '#d4d4d4' }
+        });
+        term.open(document.getElementById('terminal-container'));
+
+        const status = document.getElementById('status');
+        const playButton = document.getElementById('play');
+        const seek = document.getElementById('seek');
+        const time = document.getElementById('time');
+        const speed = document.getElementById('speed');
+        let seeking = false;
+
+        function formatTime(seconds) {
+            seconds = Math.max(0, Math.floor(seconds));
+            const m = Math.floor(seconds / 60);
+            const s = seconds % 60;
+            return m + ':' + (s < 10 ? '0' : '') + s;
+        }
+
+        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const ws = new WebSocket(protocol + '//' + window.location.host + '/ws/replay?file={{FILE_QUERY}}&csrf={{CSRF_TOKEN}}');
+
+        function send(msg) {
+            if (ws.readyState === WebSocket.OPEN) {
+                ws.send(JSON.stringify(msg));
+            }
+        }
+
+        ws.onopen = () => {
+            status.textContent = 'Playing';
+        };
+        ws.onclose = () => {
+            status.textContent = 'Disconnected';
+            status.className = 'disconnected';
+        };
+        ws.onmessage = (event) => {
+            const msg = JSON.parse(event.data);
+            if (msg.type === 'data') {
+                const binaryString = atob(msg.data);
+                const bytes = new Uint8Array(binaryString.length);
+                for (let i = 0; i < binaryString.length; i++) {
+                    bytes[i] = binaryString.charCodeAt(i);
+                }
+                term.write(bytes);
+            } else if (msg.type === 'reset') {
+                term.reset();
+            } else if (msg.type === 'resize') {
+                term.resize(msg.cols, msg.rows);
+            } else if (msg.type === 'replay') {
+                playButton.textContent = msg.paused || msg.ended ? 'Play' : 'Pause';
+                status.textContent = msg.ended ? 'Finished' : (msg.paused ? 'Paused' : 'Playing');
+                seek.max = (msg.duration || 0).toFixed(1);
+                if (!seeking) {
+                    seek.value = (msg.time || 0).toFixed(1);
+                }
+                time.textContent = formatTime(msg.time || 0) + ' / ' + formatTime(msg.duration || 0);
+            }
+        };
+
+        playButton.addEventListener('click', () => {
+            const play = playButton.textContent === 'Play';
+            if (play && Number(seek.value) >= Number(seek.max)) {
+                // Restart a finished recording
+                send({type: 'seek', time: 0});
+            }
+            send({type: play ? 'play' : 'pause'});
+        });
+        seek.addEventListener('input', () => {
+            seeking = true;
+            time.textContent = formatTime(Number(seek.value)) + ' / ' + formatTime(Number(seek.max));
+        });
+        seek.addEventListener('change', () => {
+            seeking = false;
+            send({type: 'seek', time: Number(seek.value)});
+        });
+        speed.addEventListener('change', () => {
+            send({type: 'speed', speed: Number(speed.value)});
+        });
+        document.addEventListener('keydown', (e) => {
+            if (e.key === ' ') {
+                e.preventDefault();
+                playButton.click();
+            }
+        });
+    </script>
+</body>
+</html>
+`
@@ -0,0 +1,37 @@
+package webterm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayRequiresOperator(t *testing.T) {
+	s := NewServer(0, "", "", "test")
+	s.recordDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(s.recordDir, "a.cast"), []byte("{\"version\": 2}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"/replay", "/replay?file=a.cast", "/ws/replay?file=a.cast"} {
+		r := withRole(httptest.NewRequest(http.MethodGet, target, nil), RoleViewer)
+		w := httptest.NewRecorder()
+		if target == "/ws/replay?file=a.cast" {
+			s.handleReplayWebSocket(w, r)
+		} else {
+			s.handleReplay(w, r)
+		}
+		if w.Code != http.StatusForbidden {
+			t.Errorf("viewer got %d for %s, want %d", w.Code, target, http.StatusForbidden)
+		}
+	}
+
+	r := withRole(httptest.NewRequest(http.MethodGet, "/replay", nil), RoleOperator)
+	w := httptest.NewRecorder()
+	s.handleReplay(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("operator got %d for /replay", w.Code)
+	}
+}
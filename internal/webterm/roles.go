@@ -0,0 +1,48 @@
+package webterm
+
+import (
+	"context"
+	"net/http"
+)
+
+// Role is what an authenticated web client may do.
+type Role string
+
+const (
+	// RoleOperator may type into agents and resize their terminals.
+	RoleOperator Role = "operator"
+	// RoleViewer only watches.
+	RoleViewer Role = "viewer"
+)
+
+type roleKey struct{}
+
+// shareParam is the query parameter carrying a viewer share token.
+const shareParam = "share"
+
+// SetViewerAuth adds credentials that log in as a viewer. An empty user
+// adds none.
+func (s *Server) SetViewerAuth(user, pass string) {
+	if user == "" {
+		return
+	}
+	s.AddAccounts(Account{User: user, Role: RoleViewer, Password: pass})
+}
+
+// SetShareToken lets anyone with a link carrying ?share=<token> watch as a
+// viewer without credentials. An empty token disables share links.
+func (s *Server) SetShareToken(token string) {
+	s.shareToken = token
+}
+
+// requestRole returns the role withAuth attached to r.
+func requestRole(r *http.Request) Role {
+	if role, ok := r.Context().Value(roleKey{}).(Role); ok {
+		return role
+	}
+	return RoleViewer
+}
+
+func withRole(r *http.Request, role Role) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), roleKey{}, role))
+}
@@ -1,7 +1,6 @@
 package webterm
 
 import (
-	"crypto/subtle"
 	"fmt"
 	"html"
 	"html/template"
@@ -12,60 +11,87 @@ import (
 	"sync"
 	"time"
 
+	"github.com/biliqiqi/ac2/internal/control"
 	"github.com/biliqiqi/ac2/internal/logger"
+	"github.com/biliqiqi/ac2/internal/pool"
 	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  4096,
-	WriteBufferSize: 4096,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 type Server struct {
 	port         int
-	authUser     string
-	authPass     string
+	auth         *authState
+	shareToken   string
+	tlsCert      string
+	tlsKey       string
 	agentName    string
 	agentMu      sync.RWMutex
-	proxy        *ptyproxy.Proxy
+	proxy        *ptyproxy.Proxy // current agent, guarded by proxyMu
+	proxyMu      sync.RWMutex
+	agentPool    *pool.AgentPool
+	recordDir    string
 	handlerID    string
 	clients      map[string]*Client
 	clientsMu    sync.RWMutex
 	httpServer   *http.Server
+	listener     net.Listener
 	activeSource string    // "web" or "local" or ""
 	activeTime   time.Time // last input time
 	activeMu     sync.RWMutex
+
+	// Terminal size arbitration, see size.go
+	sizeMu       sync.Mutex
+	sizePolicy   SizePolicy
+	sizeOwner    string
+	localSize    viewerSize
+	resizeTimer  *time.Timer
+	appliedSizes map[*ptyproxy.Proxy]viewerSize
+
+	// Cross-site request checks, see csrf.go
+	upgrader       websocket.Upgrader
+	allowedOrigins []string
+
+	// Agent control from the browser, see control.go
+	controller *control.Controller
 }
 
 type ClientInfo struct {
-	ID        string
-	Addr      string
-	UserAgent string
+	ID        string `json:"id"`
+	Addr      string `json:"addr"`
+	UserAgent string `json:"user_agent"`
+	AgentID   string `json:"agent_id,omitempty"` // instance the client is pinned to, empty when following the current agent
+	Role      Role   `json:"role"`
 }
 
 const disconnectCloseCode = 4001
 
 func NewServer(port int, authUser, authPass, agentName string) *Server {
-	return &Server{
-		port:      port,
-		authUser:  authUser,
-		authPass:  authPass,
-		agentName: agentName,
-		clients:   make(map[string]*Client),
-		handlerID: fmt.Sprintf("webterm-%d", time.Now().UnixNano()),
+	s := &Server{
+		port:       port,
+		auth:       newAuthState(),
+		agentName:  agentName,
+		clients:    make(map[string]*Client),
+		handlerID:  fmt.Sprintf("webterm-%d", time.Now().UnixNano()),
+		sizePolicy: SizePolicy{Mode: SizeActive},
+	}
+	s.upgrader = websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || s.originAllowed(origin, r)
+		},
+	}
+	if authUser != "" || authPass != "" {
+		s.AddAccounts(Account{User: authUser, Role: RoleOperator, Password: authPass})
 	}
+	return s
 }
 
 func (s *Server) Start(proxy *ptyproxy.Proxy) error {
-	s.proxy = proxy
-
 	// Keep local terminal output active
 	// Both local and web terminals will show output
-	proxy.AddOutputHandler(s.handlerID, s.broadcastOutput)
+	s.SetProxy(proxy)
 
 	// Start activity timeout checker
 	go s.checkActivityTimeout()
@@ -73,17 +99,77 @@ func (s *Server) Start(proxy *ptyproxy.Proxy) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/replay", s.handleReplay)
+	mux.HandleFunc("/ws/replay", s.handleReplayWebSocket)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/api/agents", s.handleAgents)
+	mux.HandleFunc("/api/agents/", s.handleAgent)
 	mux.HandleFunc("/static/xterm.css", s.handleXtermCSS)
 	mux.HandleFunc("/static/xterm.js", s.handleXtermJS)
 	mux.HandleFunc("/static/addon-fit.js", s.handleAddonFitJS)
 
 	s.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
 		Handler: s.withAuth(mux),
 	}
 
-	return s.httpServer.ListenAndServe()
+	listener := s.listener
+	if listener == nil {
+		var err error
+		listener, err = net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+		if err != nil {
+			return err
+		}
+	}
+	if s.tlsCert != "" {
+		return s.httpServer.ServeTLS(listener, s.tlsCert, s.tlsKey)
+	}
+	return s.httpServer.Serve(listener)
+}
+
+// SetListener makes Start serve on listener, e.g. a specific address or a
+// unix socket, instead of listening on the port on every interface.
+func (s *Server) SetListener(listener net.Listener) {
+	s.listener = listener
+}
+
+// SetAgentPool enables clients to attach to a specific instance with
+// /?agent=<id>, and follows instances across restarts.
+func (s *Server) SetAgentPool(agentPool *pool.AgentPool) {
+	s.agentPool = agentPool
+	agentPool.AddRestartHandler(s.handleRestart)
+}
+
+// handleRestart moves clients of a restarted instance to its new process
+// and tells every client about restart activity.
+func (s *Server) handleRestart(event pool.RestartEvent) {
+	if event.Type == pool.RestartDone {
+		if event.Previous != nil && s.swapProxy(event.Previous, event.Instance.Proxy()) {
+			s.scheduleResize()
+			s.BroadcastReset()
+		}
+		s.reattachClients(event.Instance)
+		s.scheduleResize()
+	}
+
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	for _, client := range s.clients {
+		client.SendNotice(event.String())
+	}
+}
+
+// reattachClients points clients pinned to instance at its current proxy.
+func (s *Server) reattachClients(instance *pool.AgentInstance) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	for _, client := range s.clients {
+		if client.Info().AgentID != instance.ID {
+			continue
+		}
+		client.detach()
+		client.SendReset()
+		client.attach(instance.ID, instance.Proxy())
+	}
 }
 
 func (s *Server) broadcastOutput(data []byte) {
@@ -91,34 +177,76 @@ func (s *Server) broadcastOutput(data []byte) {
 	defer s.clientsMu.RUnlock()
 
 	for _, client := range s.clients {
+		if client.pinned() {
+			continue
+		}
 		client.Send(data)
 	}
 }
 
+// lookupAgent resolves an instance ID for clients pinned to a specific agent.
+func (s *Server) lookupAgent(id string) (*pool.AgentInstance, error) {
+	if s.agentPool == nil {
+		return nil, fmt.Errorf("agent selection is not available")
+	}
+	agent, err := s.agentPool.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if agent.Status() != pool.StatusRunning || agent.Proxy() == nil {
+		return nil, fmt.Errorf("agent instance '%s' is not running", id)
+	}
+	return agent, nil
+}
+
 func (s *Server) withAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.authUser == "" && s.authPass == "" {
+		// The bundled xterm assets are public, so share links load them
+		// without credentials
+		if strings.HasPrefix(r.URL.Path, "/static/") {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		user, pass, ok := r.BasicAuth()
-		if !ok {
-			w.Header().Set("WWW-Authenticate", `Basic realm="ac2 Web Terminal"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if err := s.checkRequest(r); err != nil {
+			logger.Printf("WebTerm: rejected %s %s from %s: %v", r.Method, r.URL.Path, clientAddr(r.RemoteAddr), err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !s.authEnabled() {
+			next.ServeHTTP(w, withRole(r, RoleOperator))
 			return
 		}
 
-		userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(s.authUser)) == 1
-		passMatch := subtle.ConstantTimeCompare([]byte(pass), []byte(s.authPass)) == 1
+		switch r.URL.Path {
+		case "/login":
+			s.handleLogin(w, r)
+			return
+		case "/logout":
+			s.handleLogout(w, r)
+			return
+		}
 
-		if !userMatch || !passMatch {
-			w.Header().Set("WWW-Authenticate", `Basic realm="ac2 Web Terminal"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// Login and share links trade their token for a session cookie and
+		// drop it from the address bar
+		if role, ok := s.redeemLink(r); ok {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, withRole(r, role))
+				return
+			}
+			s.issueSession(w, r, "", role)
+			http.Redirect(w, r, withoutParams(r.URL, tokenParam, shareParam), http.StatusFound)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		role, ok := s.authenticate(r)
+		if !ok {
+			unauthorized(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, withRole(r, role))
 	})
 }
 
@@ -127,8 +255,17 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	name := s.getAgentName()
+	if id := r.URL.Query().Get("agent"); id != "" {
+		agent, err := s.lookupAgent(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		name = agent.DisplayName()
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = w.Write([]byte(renderIndexHTML(s.agentName)))
+	_, _ = w.Write([]byte(renderIndexHTML(name, s.authEnabled(), csrfToken(w, r))))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -155,25 +292,66 @@ func (s *Server) handleAddonFitJS(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	var agent *pool.AgentInstance
+	if id := r.URL.Query().Get("agent"); id != "" {
+		var err error
+		agent, err = s.lookupAgent(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 
 	clientID := fmt.Sprintf("client-%d", time.Now().UnixNano())
-	client := NewClient(clientID, conn, s, clientAddr(r.RemoteAddr), r.UserAgent())
+	client := NewClient(clientID, conn, s, clientAddr(r.RemoteAddr), r.UserAgent(), requestRole(r))
+
+	// A reconnecting browser still shows its old screen; clear it before
+	// replaying the recent output.
+	client.SendReset()
+	client.SendMessage(Message{Type: MsgTypeRole, Data: string(client.role)})
+	if agent != nil {
+		client.SendAgent(agent.DisplayName())
+		client.attach(agent.ID, agent.Proxy())
+		s.addClient(client)
+		return
+	}
+
+	client.SendAgent(s.getAgentName())
+	s.withHistory(func(history []byte) {
+		s.addClient(client)
+		if len(history) > 0 {
+			client.Send(history)
+		}
+	})
+}
 
+func (s *Server) addClient(client *Client) {
 	s.clientsMu.Lock()
-	s.clients[clientID] = client
-	s.clientsMu.Unlock()
+	defer s.clientsMu.Unlock()
+	s.clients[client.id] = client
+}
 
-	client.SendAgent(s.getAgentName())
+// withHistory runs fn with the current proxy's recent output while its
+// output is held back, so fn can register clients without gaps.
+func (s *Server) withHistory(fn func(history []byte)) {
+	proxy := s.currentProxy()
+	if proxy == nil {
+		fn(nil)
+		return
+	}
+	proxy.WithHistory(fn)
 }
 
 func (s *Server) removeClient(id string) {
 	s.clientsMu.Lock()
-	defer s.clientsMu.Unlock()
 	delete(s.clients, id)
+	s.clientsMu.Unlock()
+	s.scheduleResize()
 }
 
 func (s *Server) setActiveSource(source string) {
@@ -191,19 +369,49 @@ func (s *Server) IsWebActive() bool {
 
 func (s *Server) SetActiveSource(source string) {
 	s.setActiveSource(source)
+	if source == localViewer {
+		s.setSizeOwner(localViewer)
+	}
 }
 
 func (s *Server) SetProxy(proxy *ptyproxy.Proxy) {
+	s.proxyMu.Lock()
+	s.setProxyLocked(proxy)
+	s.proxyMu.Unlock()
+	s.scheduleResize()
+}
+
+// swapProxy makes next the current proxy if old still is, so a restart
+// does not undo a switch made in the meantime.
+func (s *Server) swapProxy(old, next *ptyproxy.Proxy) bool {
+	s.proxyMu.Lock()
+	defer s.proxyMu.Unlock()
+	if s.proxy != old {
+		return false
+	}
+	s.setProxyLocked(next)
+	return true
+}
+
+// setProxyLocked moves the output handler to proxy. Callers must hold
+// s.proxyMu.
+func (s *Server) setProxyLocked(proxy *ptyproxy.Proxy) {
 	if s.proxy != nil {
 		s.proxy.RemoveOutputHandler(s.handlerID)
 	}
-
 	s.proxy = proxy
 	if s.proxy != nil {
 		s.proxy.AddOutputHandler(s.handlerID, s.broadcastOutput)
 	}
 }
 
+// currentProxy returns the proxy of the agent that unpinned clients follow.
+func (s *Server) currentProxy() *ptyproxy.Proxy {
+	s.proxyMu.RLock()
+	defer s.proxyMu.RUnlock()
+	return s.proxy
+}
+
 func (s *Server) SetAgentName(name string) {
 	s.agentMu.Lock()
 	s.agentName = name
@@ -228,9 +436,9 @@ func (s *Server) checkActivityTimeout() {
 func (s *Server) Stop() error {
 	logger.Printf("WebServer.Stop: called")
 
-	if s.proxy != nil {
+	if proxy := s.currentProxy(); proxy != nil {
 		logger.Printf("WebServer.Stop: removing output handler")
-		s.proxy.RemoveOutputHandler(s.handlerID)
+		proxy.RemoveOutputHandler(s.handlerID)
 	}
 
 	s.clientsMu.Lock()
@@ -302,23 +510,43 @@ func (s *Server) broadcastAgentName(name string) {
 	defer s.clientsMu.RUnlock()
 
 	for _, client := range s.clients {
+		if client.pinned() {
+			continue
+		}
 		client.SendAgent(name)
 	}
 }
 
+// BroadcastReset clears the screen of clients following the current agent
+// and replays that agent's recent output.
 func (s *Server) BroadcastReset() {
-	s.clientsMu.RLock()
-	defer s.clientsMu.RUnlock()
-
-	for _, client := range s.clients {
-		client.SendReset()
-	}
+	s.withHistory(func(history []byte) {
+		s.clientsMu.RLock()
+		defer s.clientsMu.RUnlock()
+
+		for _, client := range s.clients {
+			if client.pinned() {
+				continue
+			}
+			client.SendReset()
+			if len(history) > 0 {
+				client.Send(history)
+			}
+		}
+	})
 }
 
-func renderIndexHTML(agentName string) string {
+func renderIndexHTML(agentName string, logout bool, csrf string) string {
 	escapedHTML := html.EscapeString(agentName)
 	escapedJS := template.JSEscapeString(agentName)
 	page := strings.ReplaceAll(indexHTMLTemplate, "{{AGENT_NAME}}", escapedHTML)
+	logoutHTML := ""
+	if logout {
+		logoutHTML = `<form class="logout" method="post" action="/logout">` +
+			`<input type="hidden" name="csrf" value="{{CSRF_TOKEN}}"><button type="submit">Log out</button></form>`
+	}
+	page = strings.ReplaceAll(page, "{{LOGOUT}}", logoutHTML)
+	page = strings.ReplaceAll(page, "{{CSRF_TOKEN}}", csrf)
 	return strings.ReplaceAll(page, "{{AGENT_NAME_JS}}", escapedJS)
 }
 
@@ -0,0 +1,75 @@
+package webterm
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/biliqiqi/ac2/internal/control"
+	"github.com/biliqiqi/ac2/internal/detector"
+	"github.com/biliqiqi/ac2/internal/pool"
+)
+
+// TestRestartDuringSwitch restarts the main agent while the current agent
+// keeps switching; run it with -race. The web terminal must end up on the
+// controller's current agent either way.
+func TestRestartDuringSwitch(t *testing.T) {
+	agentPool := pool.NewAgentPool([]detector.AgentInfo{{Type: "sh", Name: "Shell", Command: "sh", Found: true}}, "")
+	defer func() { _ = agentPool.Shutdown() }()
+
+	mainAgent, err := agentPool.Create("sh",
+		pool.WithArgs("-c", "sleep 0.1; exit 1"),
+		pool.WithRestart(pool.RestartConfig{Policy: pool.RestartAlways, MaxRestarts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := agentPool.Create("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := make(chan struct{})
+	s := NewServer(0, "", "", mainAgent.DisplayName())
+	s.SetProxy(mainAgent.Proxy())
+	s.SetAgentPool(agentPool)
+	controller := control.New(agentPool, mainAgent)
+	s.SetController(controller)
+	agentPool.AddRestartHandler(func(event pool.RestartEvent) {
+		if event.Type == pool.RestartDone {
+			close(restarted)
+		}
+	})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := other.ID
+			if i%2 == 1 {
+				id = mainAgent.ID
+			}
+			_, _ = controller.Switch(id)
+			_ = s.summarize(pool.AgentInfo{ID: mainAgent.ID})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-restarted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("main agent did not restart")
+	}
+	close(stop)
+	wg.Wait()
+
+	if got, want := s.currentProxy(), controller.Current().Proxy(); got != want {
+		t.Fatalf("web terminal follows %p, want current agent's proxy %p", got, want)
+	}
+}
@@ -0,0 +1,179 @@
+package webterm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ptyproxy "github.com/biliqiqi/ac2/internal/pty"
+)
+
+// Size policies decide the terminal size of an agent watched by several
+// viewers.
+const (
+	// SizeActive follows the viewer that typed last.
+	SizeActive = "active"
+	// SizeSmallest fits the smallest connected viewer.
+	SizeSmallest = "smallest"
+	// SizeFixed keeps a fixed size.
+	SizeFixed = "fixed"
+)
+
+// resizeDebounce collapses bursts of resize events, e.g. while a browser
+// window is dragged, into one resize of the agent's terminal.
+const resizeDebounce = 200 * time.Millisecond
+
+// localViewer is the size owner ID of the local terminal.
+const localViewer = "local"
+
+// SizePolicy is how the server sizes agent terminals for its viewers.
+type SizePolicy struct {
+	Mode string
+	// Cols and Rows are the size for SizeFixed.
+	Cols uint16
+	Rows uint16
+}
+
+// ParseSizePolicy parses "active", "smallest" or "fixed:COLSxROWS".
+func ParseSizePolicy(value string) (SizePolicy, error) {
+	mode, size, hasSize := strings.Cut(value, ":")
+	switch mode {
+	case SizeActive, SizeSmallest:
+		if hasSize {
+			return SizePolicy{}, fmt.Errorf("size policy %q takes no size", mode)
+		}
+		return SizePolicy{Mode: mode}, nil
+	case SizeFixed:
+		colsText, rowsText, ok := strings.Cut(strings.ToLower(size), "x")
+		cols, colsErr := strconv.ParseUint(colsText, 10, 16)
+		rows, rowsErr := strconv.ParseUint(rowsText, 10, 16)
+		if !ok || colsErr != nil || rowsErr != nil || cols == 0 || rows == 0 {
+			return SizePolicy{}, fmt.Errorf("invalid fixed size %q, expected e.g. fixed:120x40", value)
+		}
+		return SizePolicy{Mode: SizeFixed, Cols: uint16(cols), Rows: uint16(rows)}, nil
+	}
+	return SizePolicy{}, fmt.Errorf("unknown size policy %q, expected active, smallest or fixed:COLSxROWS", value)
+}
+
+func (p SizePolicy) String() string {
+	if p.Mode == SizeFixed {
+		return fmt.Sprintf("%s:%dx%d", p.Mode, p.Cols, p.Rows)
+	}
+	return p.Mode
+}
+
+type viewerSize struct {
+	id   string
+	cols uint16
+	rows uint16
+}
+
+// pick chooses the size for one agent terminal from its viewers. The active
+// policy falls back to the local terminal, then to the smallest viewer,
+// when the viewer that typed last is not watching.
+func (p SizePolicy) pick(viewers []viewerSize, owner string) (cols, rows uint16, ok bool) {
+	switch p.Mode {
+	case SizeFixed:
+		return p.Cols, p.Rows, true
+	case SizeActive:
+		for _, id := range []string{owner, localViewer} {
+			for _, v := range viewers {
+				if v.id == id {
+					return v.cols, v.rows, true
+				}
+			}
+		}
+	}
+	for _, v := range viewers {
+		if !ok || v.cols < cols {
+			cols = v.cols
+		}
+		if !ok || v.rows < rows {
+			rows = v.rows
+		}
+		ok = true
+	}
+	return cols, rows, ok
+}
+
+// SetSizePolicy changes how agent terminals are sized for viewers.
+func (s *Server) SetSizePolicy(policy SizePolicy) {
+	s.sizeMu.Lock()
+	s.sizePolicy = policy
+	s.sizeMu.Unlock()
+	s.scheduleResize()
+}
+
+// SetLocalSize reports the size of the local terminal, which views the
+// current agent alongside the web clients.
+func (s *Server) SetLocalSize(cols, rows uint16) {
+	s.sizeMu.Lock()
+	s.localSize = viewerSize{id: localViewer, cols: cols, rows: rows}
+	s.sizeMu.Unlock()
+	s.scheduleResize()
+}
+
+// setSizeOwner records the viewer that typed last.
+func (s *Server) setSizeOwner(id string) {
+	s.sizeMu.Lock()
+	changed := s.sizeOwner != id
+	s.sizeOwner = id
+	active := s.sizePolicy.Mode == SizeActive
+	s.sizeMu.Unlock()
+	if changed && active {
+		s.scheduleResize()
+	}
+}
+
+// scheduleResize applies the size policy once viewers stop changing.
+func (s *Server) scheduleResize() {
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+	if s.resizeTimer != nil {
+		s.resizeTimer.Stop()
+	}
+	s.resizeTimer = time.AfterFunc(resizeDebounce, s.applySizes)
+}
+
+// applySizes resizes every agent terminal with viewers according to the
+// size policy.
+func (s *Server) applySizes() {
+	groups := make(map[*ptyproxy.Proxy][]viewerSize)
+	s.clientsMu.RLock()
+	for _, client := range s.clients {
+		proxy := client.targetProxy()
+		cols, rows := client.size()
+		if proxy == nil || cols == 0 || rows == 0 {
+			continue
+		}
+		groups[proxy] = append(groups[proxy], viewerSize{id: client.id, cols: cols, rows: rows})
+	}
+	s.clientsMu.RUnlock()
+	current := s.currentProxy()
+
+	s.sizeMu.Lock()
+	defer s.sizeMu.Unlock()
+	if current != nil {
+		if s.localSize.cols > 0 && s.localSize.rows > 0 {
+			groups[current] = append(groups[current], s.localSize)
+		} else if _, ok := groups[current]; !ok && s.sizePolicy.Mode == SizeFixed {
+			groups[current] = nil
+		}
+	}
+
+	applied := make(map[*ptyproxy.Proxy]viewerSize, len(groups))
+	for proxy, viewers := range groups {
+		cols, rows, ok := s.sizePolicy.pick(viewers, s.sizeOwner)
+		if !ok {
+			continue
+		}
+		size := viewerSize{cols: cols, rows: rows}
+		applied[proxy] = size
+		if s.appliedSizes[proxy] == size {
+			continue
+		}
+		_ = proxy.Resize(rows, cols)
+	}
+	s.appliedSizes = applied
+}
@@ -84,6 +84,34 @@ const indexHTMLTemplate = `<!DOCTYPE html>
         #info-bar .info {
             color: var(--ink-muted);
         }
+        #info-bar .role {
+            margin-left: 6px;
+            padding: 1px 6px;
+            border-radius: 3px;
+            font-size: 12px;
+            color: var(--status-warn);
+            border: 1px solid rgba(178, 106, 0, 0.5);
+        }
+        #info-bar .role:empty {
+            display: none;
+        }
+        #info-bar .logout {
+            display: inline;
+            margin-left: 6px;
+        }
+        #info-bar .logout button {
+            font: inherit;
+            font-size: 12px;
+            color: var(--ink-muted);
+            background: none;
+            border: none;
+            padding: 0;
+            text-decoration: underline;
+            cursor: pointer;
+        }
+        .read-only .input-only {
+            display: none !important;
+        }
         #terminal-shell {
             flex: 1;
             display: flex;
@@ -122,6 +150,116 @@ const indexHTMLTemplate = `<!DOCTYPE html>
             height: 100%;
             min-width: max-content;
         }
+        .term-pane {
+            height: 100%;
+        }
+        .term-pane[hidden] {
+            display: none;
+        }
+        #tab-bar {
+            display: flex;
+            align-items: center;
+            gap: 8px;
+            padding: 4px 8px;
+            background: var(--terminal-panel);
+            flex-shrink: 0;
+        }
+        #tabs {
+            flex: 1;
+            display: flex;
+            gap: 4px;
+            overflow-x: auto;
+            min-width: 0;
+        }
+        .tab {
+            display: flex;
+            align-items: center;
+            gap: 6px;
+            padding: 4px 10px;
+            font-size: 12px;
+            color: #bdb6ad;
+            background: transparent;
+            border: 1px solid #3a3636;
+            border-radius: 4px;
+            cursor: pointer;
+            white-space: nowrap;
+            flex-shrink: 0;
+        }
+        .tab.active {
+            color: #f5f2ec;
+            background: var(--terminal-bg);
+            border-color: var(--terminal-focus-border);
+        }
+        .tab-close {
+            opacity: 0.6;
+        }
+        .tab-close:hover {
+            opacity: 1;
+        }
+        #agents-panel {
+            padding: 8px 12px;
+            background: var(--panel-bg);
+            border-bottom: 1px solid var(--panel-border);
+            font-size: 13px;
+            max-height: 40vh;
+            overflow-y: auto;
+            flex-shrink: 0;
+        }
+        #agents-panel[hidden] {
+            display: none;
+        }
+        .agent-row {
+            display: flex;
+            align-items: center;
+            gap: 8px;
+            padding: 4px 0;
+        }
+        .agent-title {
+            flex: 1;
+            min-width: 0;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            white-space: nowrap;
+        }
+        .agent-status {
+            color: var(--ink-muted);
+            font-size: 12px;
+        }
+        .agent-status.running {
+            color: var(--status-ok);
+        }
+        .agent-status.error {
+            color: var(--status-bad);
+        }
+        #clients-panel {
+            padding-top: 8px;
+            margin-top: 4px;
+            border-top: 1px solid var(--panel-border);
+        }
+        .panel-heading {
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            color: var(--ink-muted);
+            font-size: 12px;
+        }
+        #start-agent {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 6px;
+            padding-top: 8px;
+            margin-top: 4px;
+            border-top: 1px solid var(--panel-border);
+        }
+        #start-agent input,
+        #start-agent select {
+            font-size: 12px;
+            padding: 4px 6px;
+            border: 1px solid var(--button-border);
+            border-radius: 4px;
+            min-width: 0;
+            flex: 1 1 120px;
+        }
         #terminal-container .xterm-viewport {
             overflow-y: scroll !important;
             overflow-x: hidden !important;
@@ -306,12 +444,35 @@ const indexHTMLTemplate = `<!DOCTYPE html>
             <span class="title">ac2 Web Terminal</span>
             <span class="info">—</span>
             <span class="agent" id="agent-name">{{AGENT_NAME}}</span>
-            <span class="info shortcuts">│ Ctrl+C to interrupt │ Paste with Ctrl+Shift+V</span>
+            <span class="role" id="role"></span>
+            <span class="info shortcuts input-only">│ Ctrl+C to interrupt │ Paste with Ctrl+Shift+V</span>{{LOGOUT}}
         </div>
         <div id="status" class="connecting">Connecting...</div>
     </div>
     <div id="terminal-shell">
         <div id="terminal-panel">
+            <div id="tab-bar">
+                <div id="tabs"></div>
+                <button class="toolbar-button" id="btn-agents">Agents</button>
+            </div>
+            <div id="agents-panel" hidden>
+                <div id="agents-list"></div>
+                <div id="clients-panel" class="input-only">
+                    <div class="panel-heading">
+                        <span>Web clients</span>
+                        <button class="toolbar-button" id="btn-quit">Quit ac2</button>
+                    </div>
+                    <div id="clients-list"></div>
+                </div>
+                <form id="start-agent" class="input-only">
+                    <select id="start-type" aria-label="Agent type"></select>
+                    <input id="start-label" placeholder="Label">
+                    <input id="start-dir" placeholder="Directory">
+                    <input id="start-args" placeholder="Arguments">
+                    <input id="start-env" placeholder="Environment (KEY=VALUE)">
+                    <button class="toolbar-button primary" type="submit">Start</button>
+                </form>
+            </div>
             <div id="terminal-container"></div>
             <div id="toolbar">
                 <button class="toolbar-button primary" id="btn-reconnect">Reconnect</button>
@@ -320,11 +481,11 @@ const indexHTMLTemplate = `<!DOCTYPE html>
                 <button class="toolbar-button" id="btn-page-down">Page Down</button>
                 <button class="toolbar-button" id="btn-to-bottom">To Bottom</button>
                 <button class="toolbar-button" id="btn-fullscreen">Fullscreen</button>
-                <button class="toolbar-button" id="btn-up">↑</button>
-                <button class="toolbar-button" id="btn-down">↓</button>
-                <button class="toolbar-button" id="btn-left">←</button>
-                <button class="toolbar-button" id="btn-right">→</button>
-                <div id="mobile-keys">
+                <button class="toolbar-button input-only" id="btn-up">↑</button>
+                <button class="toolbar-button input-only" id="btn-down">↓</button>
+                <button class="toolbar-button input-only" id="btn-left">←</button>
+                <button class="toolbar-button input-only" id="btn-right">→</button>
+                <div id="mobile-keys" class="input-only">
                     <button class="toolbar-button" id="btn-esc">Esc</button>
                     <button class="toolbar-button" id="btn-tab">Tab</button>
                     <button class="toolbar-button" id="btn-enter">Enter</button>
@@ -356,7 +517,7 @@ const indexHTMLTemplate = `<!DOCTYPE html>
         // The UMD wrapper exports an object with FitAddon property, not the class directly
         const FitAddonConstructor = (window.FitAddon && window.FitAddon.FitAddon) || window.FitAddon;
 
-        const term = new window.Terminal({
+        const TERMINAL_OPTIONS = {
             cursorBlink: true,
             fontSize: 14,
             fontFamily: 'Courier New, monospace',
@@ -390,102 +551,248 @@ const indexHTMLTemplate = `<!DOCTYPE html>
                 brightCyan: '#29b8db',
                 brightWhite: '#e5e5e5'
             }
-        });
+        };
 
-        const fitAddon = new FitAddonConstructor();
-        term.loadAddon(fitAddon);
+        const terminalContainer = document.getElementById('terminal-container');
+        const tabBar = document.getElementById('tabs');
+        const status = document.getElementById('status');
+        const agentName = document.getElementById('agent-name');
+        if (agentName && AGENT_NAME) {
+            agentName.textContent = AGENT_NAME;
+        }
+        const maxReconnectAttempts = 5;
+        let ctrlActive = false;
+        let shiftActive = false;
 
-        term.open(document.getElementById('terminal-container'));
+        // Clients opened with ?agent=<id> attach to that instance only;
+        // share links carry their viewer token in ?share=<token>
+        const pageParams = new URLSearchParams(window.location.search);
+        const AGENT_ID = pageParams.get('agent');
+        const SHARE_TOKEN = pageParams.get('share');
+        const CSRF_TOKEN = "{{CSRF_TOKEN}}";
 
-        // Enable touch scrolling on mobile devices
-        const terminalContainer = document.getElementById('terminal-container');
-        if (terminalContainer) {
-            // Ensure touch events can scroll the viewport
-            const viewport = terminalContainer.querySelector('.xterm-viewport');
+        function wsPath(agentID) {
+            const params = new URLSearchParams();
+            if (agentID) {
+                params.set('agent', agentID);
+            }
+            if (SHARE_TOKEN) {
+                params.set('share', SHARE_TOKEN);
+            }
+            params.set('csrf', CSRF_TOKEN);
+            const query = params.toString();
+            return '/ws' + (query ? '?' + query : '');
+        }
+
+        // Each tab shows one agent over its own WebSocket. The first tab
+        // follows the current agent, or the one in ?agent=<id>.
+        const tabs = [];
+        let activeTab = null;
+
+        function createTab(agentID, title, closable) {
+            const pane = document.createElement('div');
+            pane.className = 'term-pane';
+            pane.hidden = true;
+            terminalContainer.appendChild(pane);
+
+            const tabTerm = new window.Terminal(TERMINAL_OPTIONS);
+            const fit = new FitAddonConstructor();
+            tabTerm.loadAddon(fit);
+            tabTerm.open(pane);
+            tabTerm.options.disableStdin = readOnly;
+
+            // Enable touch scrolling on mobile devices
+            const viewport = pane.querySelector('.xterm-viewport');
             if (viewport) {
-                // Prevent xterm from interfering with touch scroll
-                viewport.addEventListener('touchstart', function(e) {
-                    // Allow native scrolling behavior
-                }, { passive: true });
+                // Allow native scrolling behavior
+                viewport.addEventListener('touchstart', () => {}, { passive: true });
+                viewport.addEventListener('touchmove', () => {}, { passive: true });
+            }
+
+            const button = document.createElement('button');
+            button.className = 'tab';
+            const label = document.createElement('span');
+            label.textContent = title;
+            button.appendChild(label);
+
+            const tab = {
+                agentID: agentID,
+                title: title,
+                term: tabTerm,
+                fit: fit,
+                pane: pane,
+                button: button,
+                label: label,
+                ws: null,
+                reconnectAttempts: 0,
+                allowReconnect: true,
+                statusText: 'Connecting...',
+                statusClass: 'connecting'
+            };
 
-                viewport.addEventListener('touchmove', function(e) {
-                    // Allow native scrolling behavior
-                }, { passive: true });
+            button.addEventListener('click', () => activateTab(tab));
+            if (closable) {
+                const close = document.createElement('span');
+                close.className = 'tab-close';
+                close.textContent = '×';
+                close.title = 'Close tab';
+                close.addEventListener('click', (event) => {
+                    event.stopPropagation();
+                    closeTab(tab);
+                });
+                button.appendChild(close);
+            }
+            tabBar.appendChild(button);
+
+            tabTerm.onData((data) => {
+                const modified = applyModifiers(data);
+                sendData(tab, modified);
+            });
+            tabTerm.onResize(() => sendResize(tab));
+
+            tabs.push(tab);
+            connect(tab);
+            return tab;
+        }
+
+        function activateTab(tab) {
+            activeTab = tab;
+            tabs.forEach((t) => {
+                t.pane.hidden = t !== tab;
+                t.button.classList.toggle('active', t === tab);
+            });
+            if (agentName) {
+                agentName.textContent = tab.title;
+            }
+            renderStatus();
+            smartFit();
+            tab.term.focus();
+        }
+
+        function closeTab(tab) {
+            tab.allowReconnect = false;
+            if (tab.ws && tab.ws.readyState !== WebSocket.CLOSED) {
+                tab.ws.close();
+            }
+            tab.term.dispose();
+            tab.pane.remove();
+            tab.button.remove();
+            tabs.splice(tabs.indexOf(tab), 1);
+            if (activeTab === tab && tabs.length > 0) {
+                activateTab(tabs[0]);
+            }
+        }
+
+        // openAgent shows an agent instance in its own tab
+        function openAgent(id, title) {
+            const existing = tabs.find((t) => t.agentID === id);
+            activateTab(existing || createTab(id, title, true));
+        }
+
+        function setTabTitle(tab, title) {
+            tab.title = title;
+            tab.label.textContent = title;
+            if (tab === activeTab && agentName) {
+                agentName.textContent = title;
             }
         }
 
         // Smart fit: use fixed columns on portrait mobile to enable horizontal scroll
         function smartFit() {
+            if (!activeTab) {
+                return;
+            }
             const isPortrait = window.matchMedia('(orientation: portrait)').matches;
             const isMobile = window.matchMedia('(max-width: 768px)').matches;
 
             if (isPortrait && isMobile) {
                 // Use fixed columns on portrait mobile to preserve layout
-                const container = document.getElementById('terminal-container');
-                const rows = Math.floor((container.clientHeight - 8) / 17); // Approximate row height
-                term.resize(120, rows > 0 ? rows : 24); // Fixed 120 columns
+                const rows = Math.floor((terminalContainer.clientHeight - 8) / 17); // Approximate row height
+                activeTab.term.resize(120, rows > 0 ? rows : 24); // Fixed 120 columns
             } else {
                 // Use auto-fit on desktop and landscape mobile
-                fitAddon.fit();
+                activeTab.fit.fit();
             }
         }
 
-        smartFit();
+        // Viewers watch only: input is disabled here and ignored by the server
+        const roleBadge = document.getElementById('role');
+        let readOnly = false;
+        function setRole(role) {
+            readOnly = role === 'viewer';
+            roleBadge.textContent = readOnly ? 'Viewer · read-only' : '';
+            document.body.classList.toggle('read-only', readOnly);
+            tabs.forEach((t) => {
+                t.term.options.disableStdin = readOnly;
+            });
+        }
 
-        const status = document.getElementById('status');
-        const agentName = document.getElementById('agent-name');
-        if (agentName && AGENT_NAME) {
-            agentName.textContent = AGENT_NAME;
+        // The status badge shows the state of the active tab
+        function setStatus(tab, text, className) {
+            tab.statusText = text;
+            tab.statusClass = className;
+            if (tab === activeTab) {
+                renderStatus();
+            }
+        }
+
+        function renderStatus() {
+            if (activeTab) {
+                status.textContent = activeTab.statusText;
+                status.className = activeTab.statusClass;
+            }
+        }
+
+        // Notices (e.g. agent restarts) show in the status badge for a while
+        let noticeTimer = null;
+        function showNotice(text) {
+            status.textContent = text;
+            status.className = 'connecting';
+            clearTimeout(noticeTimer);
+            noticeTimer = setTimeout(renderStatus, 8000);
         }
-        let ws = null;
-        let reconnectAttempts = 0;
-        const maxReconnectAttempts = 5;
-        let allowReconnect = true;
-        let ctrlActive = false;
-        let shiftActive = false;
 
-        function connect() {
-            allowReconnect = true;
+        function connect(tab) {
+            tab.allowReconnect = true;
             const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-            ws = new WebSocket(protocol + '//' + window.location.host + '/ws');
+            const ws = new WebSocket(protocol + '//' + window.location.host + wsPath(tab.agentID));
+            tab.ws = ws;
 
             ws.onopen = () => {
-                status.textContent = 'Connected';
-                status.className = '';
-                reconnectAttempts = 0;
+                setStatus(tab, 'Connected', '');
+                tab.reconnectAttempts = 0;
 
                 // Send initial terminal size
-                ws.send(JSON.stringify({
-                    type: 'resize',
-                    rows: term.rows,
-                    cols: term.cols
-                }));
+                sendResize(tab);
             };
 
             ws.onclose = (event) => {
+                if (tab.ws !== ws) {
+                    return;
+                }
                 if (event && event.code === 4001) {
-                    allowReconnect = false;
-                    status.textContent = event.reason || 'Disconnected by server';
-                    status.className = 'disconnected';
+                    tab.allowReconnect = false;
+                    setStatus(tab, event.reason || 'Disconnected by server', 'disconnected');
                     return;
                 }
 
-                status.textContent = 'Disconnected';
-                status.className = 'disconnected';
+                setStatus(tab, 'Disconnected', 'disconnected');
 
                 // Attempt to reconnect
-                if (allowReconnect && reconnectAttempts < maxReconnectAttempts) {
-                    reconnectAttempts++;
-                    status.textContent = 'Reconnecting... (' + reconnectAttempts + '/' + maxReconnectAttempts + ')';
-                    status.className = 'connecting';
-                    setTimeout(connect, Math.min(1000 * reconnectAttempts, 5000));
+                if (tab.allowReconnect && tab.reconnectAttempts < maxReconnectAttempts) {
+                    tab.reconnectAttempts++;
+                    setStatus(tab, 'Reconnecting... (' + tab.reconnectAttempts + '/' + maxReconnectAttempts + ')', 'connecting');
+                    setTimeout(() => {
+                        if (tab.allowReconnect && tabs.includes(tab)) {
+                            connect(tab);
+                        }
+                    }, Math.min(1000 * tab.reconnectAttempts, 5000));
                 }
             };
 
             ws.onerror = (err) => {
                 console.error('WebSocket error:', err);
-                status.textContent = 'Error';
-                status.className = 'disconnected';
+                setStatus(tab, 'Error', 'disconnected');
             };
 
             ws.onmessage = (event) => {
@@ -499,20 +806,24 @@ const indexHTMLTemplate = `<!DOCTYPE html>
                         for (let i = 0; i < binaryString.length; i++) {
                             bytes[i] = binaryString.charCodeAt(i);
                         }
-                        term.write(bytes);
+                        tab.term.write(bytes);
                     } else if (msg.type === 'reset') {
-                        term.reset();
+                        tab.term.reset();
                     } else if (msg.type === 'agent') {
-                        if (agentName) {
-                            agentName.textContent = msg.data || 'Unknown';
+                        setTabTitle(tab, msg.data || 'Unknown');
+                    } else if (msg.type === 'role') {
+                        setRole(msg.data);
+                    } else if (msg.type === 'notice') {
+                        tab.term.write('\r\n\x1b[33m[ac2] ' + msg.data + '\x1b[0m\r\n');
+                        if (tab === activeTab) {
+                            showNotice(msg.data);
                         }
+                    } else if (msg.type === 'clients') {
+                        renderClients(msg.clients || [], msg.data);
                     } else if (msg.type === 'disconnect') {
-                        allowReconnect = false;
-                        status.textContent = msg.data || 'Disconnected by server';
-                        status.className = 'disconnected';
-                        if (ws) {
-                            ws.close();
-                        }
+                        tab.allowReconnect = false;
+                        setStatus(tab, msg.data || 'Disconnected by server', 'disconnected');
+                        ws.close();
                     } else if (msg.type === 'ping') {
                         ws.send(JSON.stringify({type: 'pong'}));
                     }
@@ -523,20 +834,22 @@ const indexHTMLTemplate = `<!DOCTYPE html>
         }
 
         function manualReconnect() {
-            reconnectAttempts = 0;
-            if (ws && ws.readyState !== WebSocket.CLOSED) {
-                ws.close();
+            const tab = activeTab;
+            tab.reconnectAttempts = 0;
+            tab.allowReconnect = false;
+            if (tab.ws && tab.ws.readyState !== WebSocket.CLOSED) {
+                tab.ws.close();
             }
-            connect();
+            connect(tab);
         }
 
         function manualDisconnect() {
-            allowReconnect = false;
-            if (ws && ws.readyState !== WebSocket.CLOSED) {
-                ws.close();
+            const tab = activeTab;
+            tab.allowReconnect = false;
+            if (tab.ws && tab.ws.readyState !== WebSocket.CLOSED) {
+                tab.ws.close();
             }
-            status.textContent = 'Disconnected';
-            status.className = 'disconnected';
+            setStatus(tab, 'Disconnected', 'disconnected');
         }
 
         async function toggleFullscreen() {
@@ -632,34 +945,199 @@ const indexHTMLTemplate = `<!DOCTYPE html>
             }
         }
 
-        function sendData(data) {
-            if (ws && ws.readyState === WebSocket.OPEN) {
+        function sendData(tab, data) {
+            if (!readOnly && tab.ws && tab.ws.readyState === WebSocket.OPEN) {
                 const encoder = new TextEncoder();
                 const bytes = encoder.encode(data);
                 let binaryString = '';
                 for (let i = 0; i < bytes.length; i++) {
                     binaryString += String.fromCharCode(bytes[i]);
                 }
-                ws.send(JSON.stringify({
+                tab.ws.send(JSON.stringify({
                     type: 'data',
                     data: btoa(binaryString)
                 }));
             }
         }
 
-        term.onData((data) => {
-            const modified = applyModifiers(data);
-            sendData(modified);
-        });
-
-        term.onResize(({rows, cols}) => {
-            if (ws && ws.readyState === WebSocket.OPEN) {
-                ws.send(JSON.stringify({
+        function sendResize(tab) {
+            if (tab.ws && tab.ws.readyState === WebSocket.OPEN) {
+                tab.ws.send(JSON.stringify({
                     type: 'resize',
-                    rows: rows,
-                    cols: cols
+                    rows: tab.term.rows,
+                    cols: tab.term.cols
                 }));
             }
+        }
+
+        // Agents panel: lists the pool's instances and starts or stops them
+        const agentsPanel = document.getElementById('agents-panel');
+        const agentsList = document.getElementById('agents-list');
+        const startForm = document.getElementById('start-agent');
+        const startType = document.getElementById('start-type');
+        let agentsTimer = null;
+
+        function agentTitle(agent) {
+            const name = agent.name || agent.type;
+            return name + ' (' + agent.id + (agent.label ? ': ' + agent.label : '') + ')';
+        }
+
+        async function api(method, path, body) {
+            const options = {method: method, headers: {'X-CSRF-Token': CSRF_TOKEN}};
+            if (body !== undefined) {
+                options.headers['Content-Type'] = 'application/json';
+                options.body = JSON.stringify(body);
+            }
+            const resp = await fetch(path, options);
+            if (!resp.ok) {
+                throw new Error((await resp.text()).trim() || resp.statusText);
+            }
+            return resp.status === 204 ? null : resp.json();
+        }
+
+        function agentButton(text, onClick) {
+            const button = document.createElement('button');
+            button.className = 'toolbar-button';
+            button.textContent = text;
+            button.addEventListener('click', onClick);
+            return button;
+        }
+
+        async function refreshAgents() {
+            let data;
+            try {
+                data = await api('GET', '/api/agents');
+            } catch (e) {
+                agentsList.textContent = e.message;
+                return;
+            }
+
+            agentsList.replaceChildren();
+            data.agents.forEach((agent) => {
+                const row = document.createElement('div');
+                row.className = 'agent-row';
+                const name = document.createElement('span');
+                name.className = 'agent-title';
+                name.textContent = agentTitle(agent) + (agent.current ? ' · current' : '');
+                const state = document.createElement('span');
+                state.className = 'agent-status ' + agent.status;
+                state.textContent = agent.status + (agent.restarts ? ' · ' + agent.restarts + ' restarts' : '');
+                row.append(name, state);
+
+                if (agent.status === 'running') {
+                    row.appendChild(agentButton('Open', () => openAgent(agent.id, agentTitle(agent))));
+                    if (!agent.current) {
+                        const use = agentButton('Switch', () => sendControl('switch', agent.id));
+                        use.classList.add('input-only');
+                        row.appendChild(use);
+                    }
+                }
+                const restart = agentButton('Restart', () => sendControl('restart', agent.id));
+                restart.classList.add('input-only');
+                row.appendChild(restart);
+                if (agent.status === 'running') {
+                    if (!agent.current) {
+                        const stop = agentButton('Stop', async () => {
+                            try {
+                                await api('DELETE', '/api/agents/' + encodeURIComponent(agent.id));
+                            } catch (e) {
+                                showNotice(e.message);
+                            }
+                            refreshAgents();
+                        });
+                        stop.classList.add('input-only');
+                        row.appendChild(stop);
+                    }
+                }
+                agentsList.appendChild(row);
+            });
+            if (data.agents.length === 0) {
+                agentsList.textContent = 'No agents';
+            }
+
+            if (!readOnly) {
+                sendControl('list-clients');
+            }
+
+            if (startType.options.length === 0) {
+                data.types.forEach((type) => {
+                    const option = document.createElement('option');
+                    option.value = type.type;
+                    option.textContent = type.name || type.type;
+                    startType.appendChild(option);
+                });
+            }
+        }
+
+        // Control messages go over any open connection; results come back
+        // as notices, client lists as 'clients' messages
+        function sendControl(type, data) {
+            const tab = [activeTab].concat(tabs).find((t) => t && t.ws && t.ws.readyState === WebSocket.OPEN);
+            if (!tab) {
+                showNotice('Not connected');
+                return;
+            }
+            tab.ws.send(JSON.stringify({type: type, data: data || ''}));
+        }
+
+        const clientsList = document.getElementById('clients-list');
+        function renderClients(clients, selfID) {
+            clientsList.replaceChildren();
+            clients.forEach((client) => {
+                const row = document.createElement('div');
+                row.className = 'agent-row';
+                const name = document.createElement('span');
+                name.className = 'agent-title';
+                name.textContent = client.addr + ' · ' + client.role + (client.agent_id ? ' · ' + client.agent_id : '') + (client.id === selfID ? ' · this page' : '');
+                name.title = client.user_agent;
+                row.appendChild(name);
+                if (client.id !== selfID) {
+                    row.appendChild(agentButton('Disconnect', () => sendControl('disconnect-client', client.id)));
+                }
+                clientsList.appendChild(row);
+            });
+        }
+
+        function toggleAgents() {
+            agentsPanel.hidden = !agentsPanel.hidden;
+            document.getElementById('btn-agents').classList.toggle('active', !agentsPanel.hidden);
+            clearInterval(agentsTimer);
+            if (!agentsPanel.hidden) {
+                refreshAgents();
+                agentsTimer = setInterval(refreshAgents, 3000);
+            }
+            setTimeout(() => smartFit(), 50);
+        }
+
+        // parseEnv turns whitespace-separated KEY=VALUE pairs into an object.
+        function parseEnv(text) {
+            const env = {};
+            for (const pair of text.split(/\s+/).filter(Boolean)) {
+                const eq = pair.indexOf('=');
+                if (eq <= 0) {
+                    throw new Error('invalid env "' + pair + '", expected KEY=VALUE');
+                }
+                env[pair.slice(0, eq)] = pair.slice(eq + 1);
+            }
+            return env;
+        }
+
+        startForm.addEventListener('submit', async (event) => {
+            event.preventDefault();
+            try {
+                const agent = await api('POST', '/api/agents', {
+                    type: startType.value,
+                    label: document.getElementById('start-label').value,
+                    dir: document.getElementById('start-dir').value,
+                    args: document.getElementById('start-args').value.split(/\s+/).filter(Boolean),
+                    env: parseEnv(document.getElementById('start-env').value)
+                });
+                startForm.reset();
+                openAgent(agent.id, agentTitle(agent));
+            } catch (e) {
+                showNotice(e.message);
+            }
+            refreshAgents();
         });
 
         window.addEventListener('resize', () => {
@@ -671,19 +1149,25 @@ const indexHTMLTemplate = `<!DOCTYPE html>
             setTimeout(() => smartFit(), 200);
         });
 
+        document.getElementById('btn-agents').addEventListener('click', toggleAgents);
+        document.getElementById('btn-quit').addEventListener('click', () => {
+            if (confirm('Quit ac2 and stop all agents?')) {
+                sendControl('quit');
+            }
+        });
         document.getElementById('btn-reconnect').addEventListener('click', manualReconnect);
-        document.getElementById('btn-clear').addEventListener('click', () => term.clear());
-        document.getElementById('btn-page-up').addEventListener('click', () => term.scrollPages(-1));
-        document.getElementById('btn-page-down').addEventListener('click', () => term.scrollPages(1));
-        document.getElementById('btn-to-bottom').addEventListener('click', () => term.scrollToBottom());
+        document.getElementById('btn-clear').addEventListener('click', () => activeTab.term.clear());
+        document.getElementById('btn-page-up').addEventListener('click', () => activeTab.term.scrollPages(-1));
+        document.getElementById('btn-page-down').addEventListener('click', () => activeTab.term.scrollPages(1));
+        document.getElementById('btn-to-bottom').addEventListener('click', () => activeTab.term.scrollToBottom());
         document.getElementById('btn-fullscreen').addEventListener('click', toggleFullscreen);
-        document.getElementById('btn-up').addEventListener('click', () => sendData('\x1b[A'));
-        document.getElementById('btn-down').addEventListener('click', () => sendData('\x1b[B'));
-        document.getElementById('btn-left').addEventListener('click', () => sendData('\x1b[D'));
-        document.getElementById('btn-right').addEventListener('click', () => sendData('\x1b[C'));
-        document.getElementById('btn-esc').addEventListener('click', () => sendData('\x1b'));
-        document.getElementById('btn-tab').addEventListener('click', () => sendData('\t'));
-        document.getElementById('btn-enter').addEventListener('click', () => sendData('\r'));
+        document.getElementById('btn-up').addEventListener('click', () => sendData(activeTab, '\x1b[A'));
+        document.getElementById('btn-down').addEventListener('click', () => sendData(activeTab, '\x1b[B'));
+        document.getElementById('btn-left').addEventListener('click', () => sendData(activeTab, '\x1b[D'));
+        document.getElementById('btn-right').addEventListener('click', () => sendData(activeTab, '\x1b[C'));
+        document.getElementById('btn-esc').addEventListener('click', () => sendData(activeTab, '\x1b'));
+        document.getElementById('btn-tab').addEventListener('click', () => sendData(activeTab, '\t'));
+        document.getElementById('btn-enter').addEventListener('click', () => sendData(activeTab, '\r'));
         document.getElementById('btn-ctrl').addEventListener('click', () => {
             ctrlActive = !ctrlActive;
             updateModifierButtons();
@@ -693,11 +1177,8 @@ const indexHTMLTemplate = `<!DOCTYPE html>
             updateModifierButtons();
         });
 
-        // Start connection
-        connect();
-
-        // Focus terminal on load
-        term.focus();
+        // Open the first tab and focus it
+        activateTab(createTab(AGENT_ID, AGENT_NAME || 'Current agent', false));
     </script>
 </body>
 </html>
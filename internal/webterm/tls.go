@@ -0,0 +1,170 @@
+package webterm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	selfSignedCertFile = "cert.pem"
+	selfSignedKeyFile  = "key.pem"
+	selfSignedValidity = 365 * 24 * time.Hour
+	// selfSignedRenewal regenerates a certificate this close to expiry.
+	selfSignedRenewal = 30 * 24 * time.Hour
+)
+
+// SetTLS serves the web terminal over HTTPS with the given certificate and
+// key files.
+func (s *Server) SetTLS(certFile, keyFile string) {
+	s.tlsCert = certFile
+	s.tlsKey = keyFile
+}
+
+// EnsureSelfSignedCert returns a self-signed certificate and key in dir,
+// generating them when they are missing, about to expire or regenerate is
+// set. Replacing the certificate makes browsers warn again, so one that
+// does not cover this machine's current addresses is kept; missing lists
+// those addresses.
+func EnsureSelfSignedCert(dir string, regenerate bool) (certFile, keyFile string, missing []string, err error) {
+	certFile = filepath.Join(dir, selfSignedCertFile)
+	keyFile = filepath.Join(dir, selfSignedKeyFile)
+	hosts := localHosts()
+
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil && !regenerate {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err == nil && time.Until(cert.NotAfter) > selfSignedRenewal {
+			// The key may predate ac2 writing it with these permissions
+			if err := os.Chmod(keyFile, 0o600); err != nil {
+				return "", "", nil, err
+			}
+			return certFile, keyFile, uncoveredHosts(cert, hosts), nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", nil, fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	certPEM, keyPEM, err := generateSelfSigned(hosts)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return "", "", nil, err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(keyFile, 0o600); err != nil {
+		return "", "", nil, err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return "", "", nil, err
+	}
+	return certFile, keyFile, nil, nil
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of the first certificate
+// in certFile, as browsers show it.
+func CertFingerprint(certFile string) (string, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("no certificate found in %s", certFile)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+func generateSelfSigned(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ac2 web terminal"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// localHosts lists the names and addresses this machine is reached by:
+// localhost, its hostname and the IPs of its interfaces.
+func localHosts() []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil && name != "" && name != "localhost" {
+		hosts = append(hosts, name)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return append(hosts, "127.0.0.1", "::1")
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+			hosts = append(hosts, ipNet.IP.String())
+		}
+	}
+	return hosts
+}
+
+// uncoveredHosts returns the hosts that cert is not valid for.
+func uncoveredHosts(cert *x509.Certificate, hosts []string) []string {
+	var missing []string
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				missing = append(missing, host)
+			}
+		} else if !slices.Contains(cert.DNSNames, host) {
+			missing = append(missing, host)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,38 @@
+package webterm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnsureSelfSignedCertKeepsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _, err := EnsureSelfSignedCert(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := CertFingerprint(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(keyFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := EnsureSelfSignedCert(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := CertFingerprint(certFile); again != first {
+		t.Fatal("a valid certificate was replaced")
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key mode %v, want 0600 (%v)", info.Mode(), err)
+	}
+
+	if _, _, _, err := EnsureSelfSignedCert(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := CertFingerprint(certFile); again == first {
+		t.Fatal("regenerate kept the old certificate")
+	}
+}